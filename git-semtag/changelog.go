@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+const defaultChangelogTemplate = `## {{ .Version }} ({{ .Date.Format "2006-01-02" }})
+{{ range .Sections }}
+### {{ .Title }}
+
+{{ range .Commits }}- {{ if .Scope }}**{{ .Scope }}:** {{ end }}{{ .Subject }} ({{ .Short }})
+{{ end }}{{ else }}
+No changes.
+{{ end }}`
+
+// changelogRelease is the data the changelog template renders for every
+// release.
+type changelogRelease struct {
+	// Version is the tag of the release, or "Unreleased".
+	Version string
+	// Previous is the tag of the previous release, empty for the first.
+	Previous string
+	Date     time.Time
+	Sections []changelogSection
+}
+
+type changelogSection struct {
+	Title   string
+	Commits []changelogCommit
+}
+
+type changelogCommit struct {
+	Hash     string
+	Short    string
+	Type     string
+	Scope    string
+	Subject  string
+	Breaking bool
+}
+
+// changelogSections are the section titles by Conventional Commit type, in
+// the order they are rendered. Breaking changes of any type are in the
+// first section and other types in the last.
+var changelogSections = []struct{ typ, title string }{
+	{"!", "Breaking Changes"},
+	{"feat", "Features"},
+	{"fix", "Bug Fixes"},
+	{"perf", "Performance Improvements"},
+	{"revert", "Reverts"},
+	{"", "Other Changes"},
+}
+
+var (
+	conventionalHeader = regexp.MustCompile(`^(\w+)(?:\(([^)]*)\))?(!)?: (.*)$`)
+	breakingFooter     = regexp.MustCompile(`(?m)^BREAKING[ -]CHANGE: `)
+)
+
+// section returns the title of the section c is in.
+func (c changelogCommit) section() string {
+	if c.Breaking {
+		return changelogSections[0].title
+	}
+	for _, s := range changelogSections {
+		if s.typ == c.Type {
+			return s.title
+		}
+	}
+	return changelogSections[len(changelogSections)-1].title
+}
+
+func parseCommit(c *object.Commit) changelogCommit {
+	header, body, _ := strings.Cut(strings.TrimSpace(c.Message), "\n")
+
+	cc := changelogCommit{
+		Hash:    c.Hash.String(),
+		Short:   c.Hash.String()[:7],
+		Subject: strings.TrimSpace(header),
+	}
+
+	if m := conventionalHeader.FindStringSubmatch(cc.Subject); m != nil {
+		cc.Type = m[1]
+		cc.Scope = m[2]
+		cc.Breaking = m[3] == "!" || breakingFooter.MatchString(body)
+		cc.Subject = m[4]
+	}
+
+	return cc
+}
+
+// changelogMain renders the changes between two revisions, or every
+// release with -all.
+func changelogMain(
+	exec string,
+	args []string,
+	stdout io.Writer,
+	stderr io.Writer,
+) error {
+	flagset := flag.NewFlagSet("git-semtag changelog", flag.ExitOnError)
+	flagAll := flagset.Bool("all", false, "render every release as a full changelog")
+	flagTemplate := flagset.String("template", "", "text/template file rendering a release, overriding the default")
+	flagOutput := flagset.String("o", "", "write to a file instead of stdout, e.g. CHANGELOG.md")
+	flagPath := flagset.String("C", "", "path in the repository, defaults to the working directory")
+	flagPrefix := flagset.String("prefix", "", "tag prefix, e.g. services/api for services/api/v1.2.3")
+
+	flagset.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s changelog [options] [from] [to]\n", exec)
+		fmt.Fprintf(stderr, "from defaults to the latest semver tag before to, to defaults to HEAD.\n")
+		flagset.PrintDefaults()
+	}
+
+	if err := flagset.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if flagset.NArg() > 2 || (*flagAll && flagset.NArg() > 0) {
+		flagset.Usage()
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flagset.Args(), " "))
+	}
+
+	text := defaultChangelogTemplate
+	if *flagTemplate != "" {
+		b, err := os.ReadFile(*flagTemplate)
+		if err != nil {
+			return err
+		}
+		text = string(b)
+	}
+
+	tmpl, err := template.New("changelog").Parse(text)
+	if err != nil {
+		return fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	prefix := normalizePrefix(*flagPrefix)
+
+	r, err := openRepo(*flagPath)
+	if err != nil {
+		return err
+	}
+
+	versions, err := tagVersions(r, prefix, stderr, true)
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(versions, func(a, b semver.Version) int {
+		return a.Compare(&b)
+	})
+
+	var releases []changelogRelease
+	if *flagAll {
+		releases, err = allReleases(r, prefix, versions)
+	} else {
+		var release changelogRelease
+		release, err = releaseBetween(r, prefix, versions, flagset.Arg(0), flagset.Arg(1))
+		releases = append(releases, release)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Render everything before writing so that a template failing on a
+	// later release does not leave a truncated -o file behind.
+	var buf bytes.Buffer
+	if *flagAll {
+		fmt.Fprintf(&buf, "# Changelog\n\n")
+	}
+
+	for i, release := range releases {
+		if i > 0 {
+			fmt.Fprintln(&buf)
+		}
+		if err := tmpl.Execute(&buf, release); err != nil {
+			return fmt.Errorf("failed to render %s: %w", release.Version, err)
+		}
+	}
+
+	if *flagOutput != "" {
+		return os.WriteFile(*flagOutput, buf.Bytes(), 0o644)
+	}
+
+	_, err = stdout.Write(buf.Bytes())
+	return err
+}
+
+// releaseBetween returns the release of the commits reachable from to but
+// not from. to defaults to HEAD and from to the highest version tag below
+// to, or the root of the history if there is none. The tag of a version
+// is prefix + v.Original().
+func releaseBetween(r *git.Repository, prefix string, versions []semver.Version, from, to string) (changelogRelease, error) {
+	if to == "" {
+		to = "HEAD"
+	}
+
+	toHash, err := r.ResolveRevision(plumbing.Revision(to))
+	if err != nil {
+		return changelogRelease{}, fmt.Errorf("failed to resolve %s: %w", to, err)
+	}
+
+	version := to
+	if to == "HEAD" {
+		version = "Unreleased"
+	}
+
+	// Find the highest version tagging to, which also names HEAD.
+	var upper *semver.Version
+	for i := len(versions) - 1; i >= 0; i-- {
+		h, err := r.ResolveRevision(plumbing.Revision(prefix + versions[i].Original()))
+		if err == nil && *h == *toHash {
+			if to == "HEAD" {
+				version = prefix + versions[i].Original()
+			}
+			upper = &versions[i]
+			break
+		}
+	}
+	if upper == nil {
+		if v, err := semver.NewVersion(strings.TrimPrefix(to, prefix)); err == nil {
+			upper = v
+		}
+	}
+
+	if from == "" {
+		for i := len(versions) - 1; i >= 0; i-- {
+			if upper != nil && !versions[i].LessThan(upper) {
+				continue
+			}
+			h, err := r.ResolveRevision(plumbing.Revision(prefix + versions[i].Original()))
+			if err == nil && *h != *toHash {
+				from = prefix + versions[i].Original()
+				break
+			}
+		}
+	}
+
+	excluded := map[plumbing.Hash]bool{}
+	if from != "" {
+		fromHash, err := r.ResolveRevision(plumbing.Revision(from))
+		if err != nil {
+			return changelogRelease{}, fmt.Errorf("failed to resolve %s: %w", from, err)
+		}
+
+		iter, err := r.Log(&git.LogOptions{From: *fromHash})
+		if err != nil {
+			return changelogRelease{}, err
+		}
+		err = iter.ForEach(func(c *object.Commit) error {
+			excluded[c.Hash] = true
+			return nil
+		})
+		if err != nil {
+			return changelogRelease{}, err
+		}
+	}
+
+	return release(r, version, from, toHash, excluded)
+}
+
+// allReleases returns a release for every version, and one for the
+// commits after the highest version if there are any, newest first. Every
+// commit is walked once: each release stops at the commits of the
+// releases before it.
+func allReleases(r *git.Repository, prefix string, versions []semver.Version) ([]changelogRelease, error) {
+	var (
+		releases []changelogRelease
+		previous string
+		seen     = map[plumbing.Hash]bool{}
+	)
+
+	for _, v := range versions {
+		tag := prefix + v.Original()
+
+		hash, err := r.ResolveRevision(plumbing.Revision(tag))
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", tag, err)
+		}
+
+		rel, err := release(r, tag, previous, hash, seen)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, rel)
+		previous = tag
+	}
+
+	head, err := r.ResolveRevision(plumbing.Revision("HEAD"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+
+	unreleased, err := release(r, "Unreleased", previous, head, seen)
+	if err != nil {
+		return nil, err
+	}
+	if len(unreleased.Sections) > 0 {
+		releases = append(releases, unreleased)
+	}
+
+	slices.Reverse(releases)
+
+	return releases, nil
+}
+
+// release returns the release named version of the commits reachable from
+// to, without walking past the commits in seen. The walked commits are
+// added to seen. Merge commits are left out.
+func release(r *git.Repository, version, from string, to *plumbing.Hash, seen map[plumbing.Hash]bool) (changelogRelease, error) {
+	toCommit, err := r.CommitObject(*to)
+	if err != nil {
+		return changelogRelease{}, err
+	}
+
+	rel := changelogRelease{
+		Version:  version,
+		Previous: from,
+		Date:     toCommit.Committer.When,
+	}
+
+	var commits []changelogCommit
+	err = object.NewCommitPreorderIter(toCommit, seen, nil).ForEach(func(c *object.Commit) error {
+		seen[c.Hash] = true
+		if c.NumParents() <= 1 {
+			commits = append(commits, parseCommit(c))
+		}
+		return nil
+	})
+	if err != nil {
+		return changelogRelease{}, err
+	}
+
+	for _, s := range changelogSections {
+		section := changelogSection{Title: s.title}
+		for _, c := range commits {
+			if c.section() == s.title {
+				section.Commits = append(section.Commits, c)
+			}
+		}
+		if len(section.Commits) > 0 {
+			rel.Sections = append(rel.Sections, section)
+		}
+	}
+
+	return rel, nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// testRepo returns a repository with a commit for every message,
+// tagged with the tag in tags at the same index if it is not empty.
+func testRepo(t *testing.T, messages []string, tags []string) *git.Repository {
+	t.Helper()
+
+	r, err := git.PlainInit(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	when := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, msg := range messages {
+		sig := &object.Signature{Name: "test", Email: "test@example.com", When: when.Add(time.Duration(i) * time.Hour)}
+		hash, err := w.Commit(msg, &git.CommitOptions{Author: sig, Committer: sig, AllowEmptyCommits: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i < len(tags) && tags[i] != "" {
+			if _, err := r.CreateTag(tags[i], hash, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	return r
+}
+
+// sections returns the titles and subjects of the sections of rel.
+func sections(rel changelogRelease) map[string][]string {
+	out := map[string][]string{}
+	for _, s := range rel.Sections {
+		for _, c := range s.Commits {
+			out[s.Title] = append(out[s.Title], c.Subject)
+		}
+	}
+	return out
+}
+
+func TestParseCommit(t *testing.T) {
+	tests := []struct {
+		message string
+		want    changelogCommit
+	}{
+		{"feat: add x", changelogCommit{Type: "feat", Subject: "add x"}},
+		{"fix(api): handle y\n", changelogCommit{Type: "fix", Scope: "api", Subject: "handle y"}},
+		{"refactor!: drop z", changelogCommit{Type: "refactor", Subject: "drop z", Breaking: true}},
+		{"fix: a\n\nBREAKING CHANGE: b", changelogCommit{Type: "fix", Subject: "a", Breaking: true}},
+		{"Update README", changelogCommit{Subject: "Update README"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			got := parseCommit(&object.Commit{Message: tt.message, Hash: plumbing.NewHash("0123456789abcdef0123456789abcdef01234567")})
+			if diff := cmp.Diff(tt.want, got, cmpopts.IgnoreFields(changelogCommit{}, "Hash", "Short")); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAllReleases(t *testing.T) {
+	r := testRepo(t,
+		[]string{
+			"feat: init",
+			"fix(api): bug",
+			"feat!: drop x",
+			"chore: deps",
+			"perf: faster",
+			"docs: readme",
+		},
+		[]string{"v1.0.0", "", "", "v2.0.0", "v2.0.1"},
+	)
+
+	versions, err := tagVersions(r, "", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.SortFunc(versions, func(a, b semver.Version) int { return a.Compare(&b) })
+
+	releases, err := allReleases(r, "", versions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type release struct {
+		Version  string
+		Previous string
+		Sections map[string][]string
+	}
+	var got []release
+	for _, rel := range releases {
+		got = append(got, release{rel.Version, rel.Previous, sections(rel)})
+	}
+
+	want := []release{
+		{"Unreleased", "v2.0.1", map[string][]string{"Other Changes": {"readme"}}},
+		{"v2.0.1", "v2.0.0", map[string][]string{"Performance Improvements": {"faster"}}},
+		{"v2.0.0", "v1.0.0", map[string][]string{
+			"Breaking Changes": {"drop x"},
+			"Bug Fixes":        {"bug"},
+			"Other Changes":    {"deps"},
+		}},
+		{"v1.0.0", "", map[string][]string{"Features": {"init"}}},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// Sections are in the order of changelogSections.
+	var titles []string
+	for _, s := range releases[2].Sections {
+		titles = append(titles, s.Title)
+	}
+	if diff := cmp.Diff([]string{"Breaking Changes", "Bug Fixes", "Other Changes"}, titles); diff != "" {
+		t.Errorf("section order mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestReleaseBetween(t *testing.T) {
+	r := testRepo(t,
+		[]string{"feat: init", "fix: a", "feat: b", "fix: c"},
+		[]string{"v1.0.0", "", "v1.1.0", ""},
+	)
+
+	versions, err := tagVersions(r, "", nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.SortFunc(versions, func(a, b semver.Version) int { return a.Compare(&b) })
+
+	tests := []struct {
+		name         string
+		from, to     string
+		wantVersion  string
+		wantPrevious string
+		want         map[string][]string
+	}{
+		{
+			name:         "HEAD since the latest tag",
+			wantVersion:  "Unreleased",
+			wantPrevious: "v1.1.0",
+			want:         map[string][]string{"Bug Fixes": {"c"}},
+		},
+		{
+			name:         "tag since the previous tag",
+			to:           "v1.1.0",
+			wantVersion:  "v1.1.0",
+			wantPrevious: "v1.0.0",
+			want:         map[string][]string{"Features": {"b"}, "Bug Fixes": {"a"}},
+		},
+		{
+			name:         "explicit range",
+			from:         "v1.0.0",
+			wantVersion:  "Unreleased",
+			wantPrevious: "v1.0.0",
+			want:         map[string][]string{"Features": {"b"}, "Bug Fixes": {"c", "a"}},
+		},
+		{
+			name:        "first release",
+			to:          "v1.0.0",
+			wantVersion: "v1.0.0",
+			want:        map[string][]string{"Features": {"init"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rel, err := releaseBetween(r, "", versions, tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rel.Version != tt.wantVersion || rel.Previous != tt.wantPrevious {
+				t.Errorf("release = %s since %q, want %s since %q", rel.Version, rel.Previous, tt.wantVersion, tt.wantPrevious)
+			}
+			if diff := cmp.Diff(tt.want, sections(rel)); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"slices"
+	"strings"
 
 	"github.com/Masterminds/semver/v3"
 	ansicolor "github.com/fatih/color"
@@ -30,14 +31,27 @@ func realMain(
 	stderr io.Writer,
 ) error {
 	exec := args[0]
+
+	if len(args) > 1 && args[1] == "next" {
+		return nextMain(exec, args[1:], stdout, stderr)
+	}
+	if len(args) > 1 && args[1] == "changelog" {
+		return changelogMain(exec, args[1:], stdout, stderr)
+	}
+
 	flagset := flag.NewFlagSet("git-semtag", flag.ExitOnError)
 	flagPreRelease := flagset.Bool("pre-release", false, "return pre-release versions only")
 	flagSortReverse := flagset.Bool("r", false, "sort in reverse order")
 	flagForceColor := flagset.Bool("fc", false, "force color output")
 	flagIgnoreInvalid := flagset.Bool("ii", false, "ignore invalid semver tags")
+	flagPrefix := flagset.String("prefix", "", "list tags with this prefix instead of unprefixed ones, e.g. services/api for services/api/v1.2.3")
+	flagLatest := flagset.Bool("latest", false, "list the latest version of every tag prefix")
+	flagPath := flagset.String("C", "", "path in the repository, defaults to the working directory")
 
 	flagset.Usage = func() {
 		fmt.Fprintf(stderr, "usage: %s [options] [path]\n", exec)
+		fmt.Fprintf(stderr, "       %s next [options] <major|minor|patch|prerelease>\n", exec)
+		fmt.Fprintf(stderr, "       %s changelog [options] [from] [to]\n", exec)
 		flagset.PrintDefaults()
 	}
 
@@ -45,56 +59,39 @@ func realMain(
 	if err != nil {
 		return err
 	}
-	_ = flagset.Args()
-
-	if *flagForceColor {
-		ansicolor.NoColor = false
-	}
 
-	cwd, err := os.Getwd()
-	if err != nil {
-		return err
+	if flagset.NArg() > 1 {
+		flagset.Usage()
+		return fmt.Errorf("expected at most one path")
 	}
 
-	r, err := git.PlainOpenWithOptions(cwd, &git.PlainOpenOptions{DetectDotGit: true})
-	if err != nil {
-		return err
+	// The path can also be given as the only argument, as it was before
+	// the subcommands, which take it with -C like git.
+	path := *flagPath
+	if flagset.NArg() == 1 {
+		if path != "" {
+			flagset.Usage()
+			return fmt.Errorf("expected either -C or a path argument")
+		}
+		path = flagset.Arg(0)
 	}
 
-	tagrefs, err := r.Tags()
-	if err != nil {
-		return err
+	if *flagForceColor {
+		ansicolor.NoColor = false
 	}
 
-	var tags []string
-	err = tagrefs.ForEach(func(t *plumbing.Reference) error {
-		tags = append(tags, t.Name().Short())
-		return nil
-	})
+	r, err := openRepo(path)
 	if err != nil {
 		return err
 	}
 
-	if len(tags) == 0 {
-		return nil
+	if *flagLatest {
+		return latestMain(r, stdout, *flagPreRelease)
 	}
 
-	var versions []semver.Version
-	for _, r := range tags {
-		v, err := semver.NewVersion(r)
-		if err != nil {
-			errstr := err.Error()
-			if errors.Is(err, semver.ErrInvalidSemVer) {
-				errstr = "invalid semver"
-			}
-
-			if !*flagIgnoreInvalid {
-				fmt.Fprintf(stderr, "%v: %v\n", colorError.Sprintf("%v", errstr), r)
-			}
-			continue
-		}
-
-		versions = append(versions, *v)
+	versions, err := tagVersions(r, normalizePrefix(*flagPrefix), stderr, *flagIgnoreInvalid)
+	if err != nil {
+		return err
 	}
 
 	sortFunc := func(a, b semver.Version) int {
@@ -130,6 +127,63 @@ func realMain(
 	return nil
 }
 
+// openRepo opens the repository containing path, which defaults to the
+// working directory.
+func openRepo(path string) (*git.Repository, error) {
+	if path == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		path = cwd
+	}
+
+	return git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+}
+
+// tagVersions returns the versions of the semver tags of r starting with
+// prefix, which is stripped before parsing, reporting other tags with the
+// prefix on stderr unless ignoreInvalid is set. Tags with a longer prefix,
+// such as every prefixed tag when prefix is empty, are skipped: -latest
+// lists them. The tag of a version v is prefix + v.Original().
+func tagVersions(r *git.Repository, prefix string, stderr io.Writer, ignoreInvalid bool) ([]semver.Version, error) {
+	tagrefs, err := r.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	err = tagrefs.ForEach(func(t *plumbing.Reference) error {
+		if tag, ok := strings.CutPrefix(t.Name().Short(), prefix); ok && !strings.Contains(tag, "/") {
+			tags = append(tags, tag)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []semver.Version
+	for _, r := range tags {
+		v, err := semver.NewVersion(r)
+		if err != nil {
+			errstr := err.Error()
+			if errors.Is(err, semver.ErrInvalidSemVer) {
+				errstr = "invalid semver"
+			}
+
+			if !ignoreInvalid {
+				fmt.Fprintf(stderr, "%v: %v\n", colorError.Sprintf("%v", errstr), prefix+r)
+			}
+			continue
+		}
+
+		versions = append(versions, *v)
+	}
+
+	return versions, nil
+}
+
 func filter[T any](s []T, f func(T) bool) []T {
 	var r []T
 	for _, v := range s {
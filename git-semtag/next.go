@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// nextMain creates an annotated tag on HEAD for the version following the
+// highest semver tag.
+func nextMain(
+	exec string,
+	args []string,
+	stdout io.Writer,
+	stderr io.Writer,
+) error {
+	flagset := flag.NewFlagSet("git-semtag next", flag.ExitOnError)
+	flagDry := flagset.Bool("dry", false, "print the tag without creating it")
+	flagV := flagset.Bool("v", false, "prefix the tag with v; by default the prefix of the highest tag is kept")
+	flagMessage := flagset.String("m", "", "tag message, defaults to the tag name")
+	flagPreID := flagset.String("pre-id", "alpha", "prerelease identifier used when bumping a release to a prerelease")
+	flagPush := flagset.Bool("push", false, "push the tag to the remote")
+	flagRemote := flagset.String("remote", "origin", "remote to push the tag to")
+	flagPath := flagset.String("C", "", "path in the repository, defaults to the working directory")
+	flagPrefix := flagset.String("prefix", "", "tag prefix, e.g. services/api for services/api/v1.2.3")
+
+	flagset.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s next [options] <major|minor|patch|prerelease>\n", exec)
+		flagset.PrintDefaults()
+	}
+
+	if err := flagset.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if flagset.NArg() != 1 {
+		flagset.Usage()
+		return fmt.Errorf("next requires exactly one argument: major, minor, patch, or prerelease")
+	}
+
+	bumpType := flagset.Arg(0)
+	if bumpType != "patch" && bumpType != "minor" && bumpType != "major" && bumpType != "prerelease" {
+		return fmt.Errorf("invalid bump type: %s (must be patch, minor, major, or prerelease)", bumpType)
+	}
+
+	prefix := normalizePrefix(*flagPrefix)
+
+	r, err := openRepo(*flagPath)
+	if err != nil {
+		return err
+	}
+
+	head, err := r.Head()
+	if err != nil {
+		return fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+
+	if err := checkClean(r); err != nil {
+		return err
+	}
+
+	tagged, err := tagsAt(r, head.Hash())
+	if err != nil {
+		return err
+	}
+	tagged = filter(tagged, func(tag string) bool {
+		tag, ok := strings.CutPrefix(tag, prefix)
+		if !ok {
+			return false
+		}
+		_, err := semver.NewVersion(tag)
+		return err == nil
+	})
+	if len(tagged) > 0 {
+		return fmt.Errorf("HEAD is already tagged with a version: %s", strings.Join(tagged, ", "))
+	}
+
+	versions, err := tagVersions(r, prefix, stderr, true)
+	if err != nil {
+		return err
+	}
+
+	latest := semver.MustParse("0.0.0")
+	if len(versions) > 0 {
+		v := slices.MaxFunc(versions, func(a, b semver.Version) int {
+			return a.Compare(&b)
+		})
+		latest = &v
+	}
+
+	next, err := bump(latest, bumpType, *flagPreID)
+	if err != nil {
+		return err
+	}
+
+	name := next.Original()
+	if *flagV && !strings.HasPrefix(name, "v") {
+		name = "v" + name
+	}
+	name = prefix + name
+
+	if *flagDry {
+		fmt.Fprintf(stderr, "would tag %s as %s\n", head.Hash().String()[:7], name)
+		fmt.Fprintln(stdout, name)
+		return nil
+	}
+
+	message := *flagMessage
+	if message == "" {
+		message = name
+	}
+
+	if _, err := r.CreateTag(name, head.Hash(), &git.CreateTagOptions{Message: message}); err != nil {
+		return fmt.Errorf("failed to create tag %s: %w", name, err)
+	}
+
+	if *flagPush {
+		refspec := config.RefSpec(fmt.Sprintf("refs/tags/%s:refs/tags/%s", name, name))
+		err := r.Push(&git.PushOptions{
+			RemoteName: *flagRemote,
+			RefSpecs:   []config.RefSpec{refspec},
+		})
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return fmt.Errorf("failed to push tag %s: %w", name, err)
+		}
+	}
+
+	fmt.Fprintln(stdout, name)
+
+	return nil
+}
+
+// bump returns the version following v. A prerelease bump increments the
+// last numeric identifier of the prerelease, or starts preID.0 on the next
+// patch version of a release.
+func bump(v *semver.Version, bumpType, preID string) (*semver.Version, error) {
+	var next semver.Version
+	switch bumpType {
+	case "patch":
+		next = v.IncPatch()
+	case "minor":
+		next = v.IncMinor()
+	case "major":
+		next = v.IncMajor()
+	case "prerelease":
+		pre := v.Prerelease()
+		if pre == "" {
+			n, err := v.IncPatch().SetPrerelease(preID + ".0")
+			if err != nil {
+				return nil, fmt.Errorf("failed to set prerelease: %w", err)
+			}
+			return &n, nil
+		}
+
+		ids := strings.Split(pre, ".")
+		n, err := strconv.Atoi(ids[len(ids)-1])
+		if err != nil {
+			ids = append(ids, "0")
+		} else {
+			ids[len(ids)-1] = strconv.Itoa(n + 1)
+		}
+
+		next, err = v.SetPrerelease(strings.Join(ids, "."))
+		if err != nil {
+			return nil, fmt.Errorf("failed to set prerelease: %w", err)
+		}
+		next, err = next.SetMetadata("")
+		if err != nil {
+			return nil, fmt.Errorf("failed to reset metadata: %w", err)
+		}
+	}
+
+	return &next, nil
+}
+
+// checkClean returns an error if the worktree of r has changes to tracked
+// files. Untracked files are ignored, as by git describe --dirty.
+func checkClean(r *git.Repository) error {
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return err
+	}
+
+	var dirty []string
+	for path, s := range status {
+		if s.Worktree == git.Untracked {
+			continue
+		}
+		if s.Worktree != git.Unmodified || s.Staging != git.Unmodified {
+			dirty = append(dirty, path)
+		}
+	}
+
+	if len(dirty) > 0 {
+		slices.Sort(dirty)
+		return fmt.Errorf("working tree is dirty: %s", strings.Join(dirty, ", "))
+	}
+
+	return nil
+}
+
+// tagsAt returns the tags pointing at the commit hash, directly or through
+// an annotated tag.
+func tagsAt(r *git.Repository, hash plumbing.Hash) ([]string, error) {
+	tagrefs, err := r.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []string
+	err = tagrefs.ForEach(func(t *plumbing.Reference) error {
+		target := t.Hash()
+		if tag, err := r.TagObject(target); err == nil {
+			target = tag.Target
+		}
+		if target == hash {
+			tags = append(tags, t.Name().Short())
+		}
+		return nil
+	})
+
+	return tags, err
+}
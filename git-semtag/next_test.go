@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+func TestBump(t *testing.T) {
+	tests := []struct {
+		version  string
+		bumpType string
+		preID    string
+		want     string
+	}{
+		{"1.2.3", "patch", "alpha", "1.2.4"},
+		{"1.2.3", "minor", "alpha", "1.3.0"},
+		{"1.2.3", "major", "alpha", "2.0.0"},
+		{"v1.2.3", "minor", "alpha", "v1.3.0"},
+		{"1.2.3", "prerelease", "alpha", "1.2.4-alpha.0"},
+		{"1.2.3", "prerelease", "rc", "1.2.4-rc.0"},
+		{"1.2.4-alpha.0", "prerelease", "alpha", "1.2.4-alpha.1"},
+		{"1.2.4-beta", "prerelease", "alpha", "1.2.4-beta.0"},
+		{"1.2.4-rc.1+build.7", "prerelease", "alpha", "1.2.4-rc.2"},
+		{"1.2.4-rc.1", "patch", "alpha", "1.2.4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version+"/"+tt.bumpType, func(t *testing.T) {
+			got, err := bump(semver.MustParse(tt.version), tt.bumpType, tt.preID)
+			if err != nil {
+				t.Fatalf("bump: %v", err)
+			}
+			if got.Original() != tt.want {
+				t.Errorf("bump = %s, want %s", got.Original(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// normalizePrefix returns the tag prefix of a monorepo path such as
+// services/api, which is separated from versions by a slash.
+func normalizePrefix(prefix string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		return prefix
+	}
+	return prefix + "/"
+}
+
+// latestMain prints the latest version of every tag prefix of r, the
+// prefix being everything up to the last slash of a tag. Tags without a
+// prefix are listed as ".". Only releases are considered, or only
+// prereleases if preRelease is set.
+func latestMain(r *git.Repository, stdout io.Writer, preRelease bool) error {
+	tagrefs, err := r.Tags()
+	if err != nil {
+		return err
+	}
+
+	latest := map[string]*semver.Version{}
+	err = tagrefs.ForEach(func(t *plumbing.Reference) error {
+		tag := t.Name().Short()
+
+		prefix := "."
+		if i := strings.LastIndex(tag, "/"); i >= 0 {
+			prefix, tag = tag[:i], tag[i+1:]
+		}
+
+		v, err := semver.NewVersion(tag)
+		if err != nil || (v.Prerelease() != "") != preRelease {
+			return nil
+		}
+
+		if l, ok := latest[prefix]; !ok || v.GreaterThan(l) {
+			latest[prefix] = v
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	prefixes := make([]string, 0, len(latest))
+	for prefix := range latest {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+
+	for _, prefix := range prefixes {
+		v := latest[prefix]
+
+		color := colorRelease
+		if v.Prerelease() != "" {
+			color = colorPreRelease
+		}
+
+		fmt.Fprintf(stdout, "%s\t%s\n", prefix, color.Sprintf("%v", v.Original()))
+	}
+
+	return nil
+}
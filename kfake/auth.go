@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+const (
+	saslPlain       = "PLAIN"
+	saslScramSha256 = "SCRAM-SHA-256"
+	saslScramSha512 = "SCRAM-SHA-512"
+)
+
+type saslUser struct {
+	mechanism string
+	user      string
+	pass      string
+}
+
+func (u saslUser) saslMechanism() sasl.Mechanism {
+	switch u.mechanism {
+	case saslScramSha256:
+		return scram.Auth{User: u.user, Pass: u.pass}.AsSha256Mechanism()
+	case saslScramSha512:
+		return scram.Auth{User: u.user, Pass: u.pass}.AsSha512Mechanism()
+	default:
+		return plain.Auth{User: u.user, Pass: u.pass}.AsMechanism()
+	}
+}
+
+type saslUserFlag []saslUser
+
+func (f *saslUserFlag) String() string {
+	if f == nil {
+		return ""
+	}
+
+	users := make([]string, 0, len(*f))
+	for _, u := range *f {
+		users = append(users, u.mechanism+":"+u.user)
+	}
+
+	return strings.Join(users, ",")
+}
+
+func (f *saslUserFlag) Set(s string) error {
+	mechanism, rest, ok := strings.Cut(s, ":")
+	if !ok {
+		return fmt.Errorf("expected mechanism:user:pass, got %q", s)
+	}
+
+	user, pass, ok := strings.Cut(rest, ":")
+	if !ok || user == "" {
+		return fmt.Errorf("expected mechanism:user:pass, got %q", s)
+	}
+
+	mechanism = strings.ToUpper(mechanism)
+	switch mechanism {
+	case saslPlain, saslScramSha256, saslScramSha512:
+	default:
+		return fmt.Errorf("invalid SASL mechanism %q (expected: %s|%s|%s)", mechanism, saslPlain, saslScramSha256, saslScramSha512)
+	}
+
+	*f = append(*f, saslUser{mechanism: mechanism, user: user, pass: pass})
+	return nil
+}
+
+// tlsMaterial is a generated CA with a server and a client certificate
+// signed by it.
+type tlsMaterial struct {
+	server *tls.Config
+	client *tls.Config
+}
+
+// generateTLS creates a self-signed CA, issues a server certificate for
+// hosts and a client certificate, and writes ca.pem, client.pem and
+// client-key.pem to dir so tests can trust the cluster and authenticate
+// with mutual TLS.
+func generateTLS(dir string, hosts []string) (*tlsMaterial, error) {
+	now := time.Now()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	caTmpl := &x509.Certificate{
+		SerialNumber:          serialNumber(),
+		Subject:               pkix.Name{CommonName: "kfake CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("create CA certificate: %w", err)
+	}
+
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	issue := func(cn string, usage x509.ExtKeyUsage, hosts []string) (tls.Certificate, []byte, []byte, error) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return tls.Certificate{}, nil, nil, err
+		}
+
+		tmpl := &x509.Certificate{
+			SerialNumber: serialNumber(),
+			Subject:      pkix.Name{CommonName: cn},
+			NotBefore:    now.Add(-time.Hour),
+			NotAfter:     now.AddDate(1, 0, 0),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		for _, h := range hosts {
+			if ip := net.ParseIP(h); ip != nil {
+				tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+			} else {
+				tmpl.DNSNames = append(tmpl.DNSNames, h)
+			}
+		}
+
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+		if err != nil {
+			return tls.Certificate{}, nil, nil, fmt.Errorf("create %s certificate: %w", cn, err)
+		}
+
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return tls.Certificate{}, nil, nil, err
+		}
+
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		return cert, certPEM, keyPEM, err
+	}
+
+	serverCert, _, _, err := issue("kfake", x509.ExtKeyUsageServerAuth, hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	clientCert, clientPEM, clientKeyPEM, err := issue("kfake client", x509.ExtKeyUsageClientAuth, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		name string
+		data []byte
+		perm os.FileMode
+	}{
+		{"ca.pem", caPEM, 0o644},
+		{"client.pem", clientPEM, 0o644},
+		{"client-key.pem", clientKeyPEM, 0o600},
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f.name), f.data, f.perm); err != nil {
+			return nil, err
+		}
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	return &tlsMaterial{
+		server: &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientCAs:    pool,
+			ClientAuth:   tls.VerifyClientCertIfGiven,
+			MinVersion:   tls.VersionTLS12,
+		},
+		client: &tls.Config{
+			Certificates: []tls.Certificate{clientCert},
+			RootCAs:      pool,
+			MinVersion:   tls.VersionTLS12,
+		},
+	}, nil
+}
+
+func serialNumber() *big.Int {
+	n, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// clientOpts returns the kgo options needed to talk to a cluster built
+// from f, for the tool's own clients.
+func (f *clusterFlags) clientOpts(addrs []string) []kgo.Opt {
+	opts := []kgo.Opt{kgo.SeedBrokers(addrs...)}
+
+	if f.tls != nil {
+		opts = append(opts, kgo.DialTLSConfig(f.tls.client.Clone()))
+	}
+
+	if len(f.saslUsers) > 0 {
+		opts = append(opts, kgo.SASL(f.saslUsers[0].saslMechanism()))
+	}
+
+	return opts
+}
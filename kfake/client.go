@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// connFlags are the connection flags of the produce and consume
+// subcommands, which talk to an already running cluster.
+type connFlags struct {
+	brokers string
+	sasl    saslUserFlag
+	tlsDir  string
+}
+
+func (f *connFlags) register(flagset *flag.FlagSet) {
+	flagset.StringVar(&f.brokers, "brokers", "localhost:9092", "bootstrap brokers (comma-separated)")
+	flagset.StringVar(&f.brokers, "b", "localhost:9092", "bootstrap brokers (shorthand)")
+	flagset.Var(&f.sasl, "sasl", "authenticate with mechanism:user:pass, mechanism is PLAIN|SCRAM-SHA-256|SCRAM-SHA-512")
+	flagset.StringVar(&f.tlsDir, "tls-dir", "", "connect with TLS trusting dir/ca.pem, presenting dir/client.pem if present")
+}
+
+func (f *connFlags) options() ([]kgo.Opt, error) {
+	brokers := parseCSV(f.brokers)
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("at least one broker is required")
+	}
+
+	opts := []kgo.Opt{kgo.SeedBrokers(brokers...)}
+
+	if len(f.sasl) > 0 {
+		opts = append(opts, kgo.SASL(f.sasl[len(f.sasl)-1].saslMechanism()))
+	}
+
+	if f.tlsDir != "" {
+		ca, err := os.ReadFile(filepath.Join(f.tlsDir, "ca.pem"))
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("tls: no certificates in %s", filepath.Join(f.tlsDir, "ca.pem"))
+		}
+
+		cfg := &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+
+		cert, err := tls.LoadX509KeyPair(filepath.Join(f.tlsDir, "client.pem"), filepath.Join(f.tlsDir, "client-key.pem"))
+		switch {
+		case err == nil:
+			cfg.Certificates = []tls.Certificate{cert}
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+
+		opts = append(opts, kgo.DialTLSConfig(cfg))
+	}
+
+	return opts, nil
+}
+
+// jsonRecord is the JSON form of a record read by produce -format json and
+// printed by consume.
+type jsonRecord struct {
+	Topic     string            `json:"topic,omitempty"`
+	Partition *int32            `json:"partition,omitempty"`
+	Offset    *int64            `json:"offset,omitempty"`
+	Timestamp *time.Time        `json:"timestamp,omitempty"`
+	Key       *string           `json:"key,omitempty"`
+	Value     string            `json:"value"`
+	Headers   map[string]string `json:"headers,omitempty"`
+}
+
+func produceMain(ctx context.Context, args []string, stdin io.Reader, _ io.Writer, stderr io.Writer) error {
+	flagset := flag.NewFlagSet("kfake produce", flag.ExitOnError)
+	flagset.SetOutput(stderr)
+	flagset.Usage = func() {
+		fmt.Fprintf(stderr, "usage: kfake produce [options] -topic <topic> < records\n")
+		flagset.PrintDefaults()
+	}
+
+	var (
+		flagConn   connFlags
+		flagTopic  string
+		flagFormat string
+	)
+
+	flagConn.register(flagset)
+	flagset.StringVar(&flagTopic, "topic", "", "topic to produce to, unless set per record")
+	flagset.StringVar(&flagTopic, "t", "", "topic (shorthand)")
+	flagset.StringVar(&flagFormat, "format", "lines", "input format: lines|json")
+
+	if err := flagset.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if flagFormat != "lines" && flagFormat != "json" {
+		return fmt.Errorf("invalid format %q (expected: lines|json)", flagFormat)
+	}
+
+	if flagFormat == "lines" && flagTopic == "" {
+		flagset.Usage()
+		return fmt.Errorf("-topic is required")
+	}
+
+	opts, err := flagConn.options()
+	if err != nil {
+		return err
+	}
+	opts = append(opts, kgo.RecordPartitioner(explicitPartitioner{kgo.StickyKeyPartitioner(nil)}))
+	if flagTopic != "" {
+		opts = append(opts, kgo.DefaultProduceTopic(flagTopic))
+	}
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var (
+		mu       sync.Mutex
+		produced int
+		firstErr error
+	)
+
+	scanner := bufio.NewScanner(stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+
+		r := &kgo.Record{Partition: -1}
+		if flagFormat == "lines" {
+			r.Value = []byte(text)
+		} else {
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+
+			var jr jsonRecord
+			if err := json.Unmarshal([]byte(text), &jr); err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+
+			r.Topic = jr.Topic
+			r.Value = []byte(jr.Value)
+			if jr.Key != nil {
+				r.Key = []byte(*jr.Key)
+			}
+			if jr.Partition != nil {
+				r.Partition = *jr.Partition
+			}
+			if jr.Timestamp != nil {
+				r.Timestamp = *jr.Timestamp
+			}
+			for k, v := range jr.Headers {
+				r.Headers = append(r.Headers, kgo.RecordHeader{Key: k, Value: []byte(v)})
+			}
+
+			if r.Topic == "" && flagTopic == "" {
+				return fmt.Errorf("line %d: no topic in record and -topic not set", line)
+			}
+		}
+
+		client.Produce(ctx, r, func(r *kgo.Record, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				fmt.Fprintf(stderr, "produce %s: %v\n", r.Topic, err)
+				return
+			}
+			produced++
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if err := client.Flush(ctx); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stderr, "produced %d records\n", produced)
+
+	return firstErr
+}
+
+// explicitPartitioner sends records that have a partition set (>= 0) to
+// that partition, and partitions the rest with the wrapped partitioner.
+type explicitPartitioner struct {
+	kgo.Partitioner
+}
+
+func (p explicitPartitioner) ForTopic(topic string) kgo.TopicPartitioner {
+	return explicitTopicPartitioner{p.Partitioner.ForTopic(topic)}
+}
+
+type explicitTopicPartitioner struct {
+	kgo.TopicPartitioner
+}
+
+func (p explicitTopicPartitioner) RequiresConsistency(r *kgo.Record) bool {
+	return r.Partition >= 0 || p.TopicPartitioner.RequiresConsistency(r)
+}
+
+func (p explicitTopicPartitioner) Partition(r *kgo.Record, n int) int {
+	if r.Partition >= 0 {
+		return int(r.Partition)
+	}
+	return p.TopicPartitioner.Partition(r, n)
+}
+
+// OnNewBatch keeps the wrapped sticky partitioner moving between
+// partitions for records without a key.
+func (p explicitTopicPartitioner) OnNewBatch() {
+	if nb, ok := p.TopicPartitioner.(kgo.TopicPartitionerOnNewBatch); ok {
+		nb.OnNewBatch()
+	}
+}
+
+func consumeMain(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) error {
+	flagset := flag.NewFlagSet("kfake consume", flag.ExitOnError)
+	flagset.SetOutput(stderr)
+	flagset.Usage = func() {
+		fmt.Fprintf(stderr, "usage: kfake consume [options] -topic <topic>\n")
+		flagset.PrintDefaults()
+	}
+
+	var (
+		flagConn   connFlags
+		flagTopics string
+		flagGroup  string
+		flagOffset string
+		flagNum    int
+	)
+
+	flagConn.register(flagset)
+	flagset.StringVar(&flagTopics, "topic", "", "topics to consume (comma-separated)")
+	flagset.StringVar(&flagTopics, "t", "", "topics (shorthand)")
+	flagset.StringVar(&flagGroup, "group", "", "consume as part of this consumer group, committing offsets")
+	flagset.StringVar(&flagGroup, "g", "", "consumer group (shorthand)")
+	flagset.StringVar(&flagOffset, "offset", "start", "where to start without a committed offset: start|end|<offset>|@<unix-millis>")
+	flagset.IntVar(&flagNum, "n", 0, "exit after this many records, 0 to consume until interrupted")
+
+	if err := flagset.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	topics := parseCSV(flagTopics)
+	if len(topics) == 0 {
+		flagset.Usage()
+		return fmt.Errorf("-topic is required")
+	}
+
+	offset, err := parseOffset(flagOffset)
+	if err != nil {
+		return err
+	}
+
+	opts, err := flagConn.options()
+	if err != nil {
+		return err
+	}
+	opts = append(opts,
+		kgo.ConsumeTopics(topics...),
+		kgo.ConsumeResetOffset(offset),
+	)
+	if flagGroup != "" {
+		// Only records that were printed are committed, so -n does not
+		// skip the rest of the last fetch for the next consumer.
+		opts = append(opts, kgo.ConsumerGroup(flagGroup), kgo.AutoCommitMarks())
+	}
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	enc := json.NewEncoder(stdout)
+	consumed := 0
+	for {
+		fetches := client.PollFetches(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		var fetchErr error
+		fetches.EachError(func(topic string, partition int32, err error) {
+			if fetchErr == nil {
+				fetchErr = fmt.Errorf("fetch %s/%d: %w", topic, partition, err)
+			}
+		})
+		if fetchErr != nil {
+			return fetchErr
+		}
+
+		iter := fetches.RecordIter()
+		for !iter.Done() {
+			r := iter.Next()
+
+			jr := jsonRecord{
+				Topic:     r.Topic,
+				Partition: &r.Partition,
+				Offset:    &r.Offset,
+				Timestamp: &r.Timestamp,
+				Value:     string(r.Value),
+			}
+			if r.Key != nil {
+				key := string(r.Key)
+				jr.Key = &key
+			}
+			if len(r.Headers) > 0 {
+				jr.Headers = make(map[string]string, len(r.Headers))
+				for _, h := range r.Headers {
+					jr.Headers[h.Key] = string(h.Value)
+				}
+			}
+
+			if err := enc.Encode(jr); err != nil {
+				return err
+			}
+
+			if flagGroup != "" {
+				client.MarkCommitRecords(r)
+			}
+
+			consumed++
+			if flagNum > 0 && consumed >= flagNum {
+				if flagGroup != "" {
+					return client.CommitMarkedOffsets(context.WithoutCancel(ctx))
+				}
+				return nil
+			}
+		}
+	}
+}
+
+func parseOffset(s string) (kgo.Offset, error) {
+	switch s {
+	case "start":
+		return kgo.NewOffset().AtStart(), nil
+	case "end":
+		return kgo.NewOffset().AtEnd(), nil
+	}
+
+	if ms, ok := strings.CutPrefix(s, "@"); ok {
+		v, err := strconv.ParseInt(ms, 10, 64)
+		if err != nil {
+			return kgo.Offset{}, fmt.Errorf("invalid timestamp offset %q: %w", s, err)
+		}
+		return kgo.NewOffset().AfterMilli(v), nil
+	}
+
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 {
+		return kgo.Offset{}, fmt.Errorf("invalid offset %q (expected: start|end|<offset>|@<unix-millis>)", s)
+	}
+	return kgo.NewOffset().At(v), nil
+}
@@ -10,9 +10,11 @@ import (
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/twmb/franz-go/pkg/kfake"
 	"github.com/twmb/franz-go/pkg/kversion"
@@ -22,49 +24,81 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	if err := realMain(ctx, os.Args, os.Stdout, os.Stderr); err != nil {
+	if err := realMain(ctx, os.Args, os.Stdin, os.Stdout, os.Stderr); err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
 		os.Exit(1)
 	}
 }
 
-func realMain(ctx context.Context, osargs []string, stdout io.Writer, stderr io.Writer) error {
+func realMain(ctx context.Context, osargs []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	if len(osargs) > 1 {
+		switch osargs[1] {
+		case "replay":
+			return replayMain(ctx, osargs[1:], stdout, stderr)
+		case "produce":
+			return produceMain(ctx, osargs[1:], stdin, stdout, stderr)
+		case "consume":
+			return consumeMain(ctx, osargs[1:], stdout, stderr)
+		case "scenario":
+			return scenarioMain(ctx, osargs[1:], stdout, stderr)
+		}
+	}
+
 	flagset := flag.NewFlagSet("kfake", flag.ExitOnError)
 	flagset.SetOutput(stderr)
 
 	var (
-		flagLogLevel   string
-		flagVersion    string
-		flagPprofAddr  string
-		flagPorts      string
-		flagSeedTopics string
-		flagBcfgs      = make(brokerConfigFlag)
+		flagPprofAddr string
+		flagRecord    string
+		flagDataDir   string
+		flagInterval  time.Duration
+		flagReadyFile string
+		flagHealth    string
+		flagRegistry  string
+		flagSchemaDir string
+		flagCluster   = newClusterFlags()
 	)
 
-	flagset.StringVar(&flagLogLevel, "log-level", "none", "log level: none|error|warn|info|debug")
-	flagset.StringVar(&flagLogLevel, "l", "none", "log level (shorthand)")
-	flagset.StringVar(&flagVersion, "as-version", "", "Kafka version to emulate (e.g. 2.8, 3.5)")
+	flagCluster.register(flagset)
 	flagset.StringVar(&flagPprofAddr, "pprof", "", "pprof port on 127.0.0.1 (e.g. :6060), empty to disable")
-	flagset.StringVar(&flagPorts, "ports", "9092,9093,9094", "broker ports (comma-separated)")
-	flagset.StringVar(&flagSeedTopics, "seed-topics", "foo", "topics to seed (comma-separated)")
-	flagset.Var(flagBcfgs, "broker-config", "broker config key=value (repeatable)")
-	flagset.Var(flagBcfgs, "c", "broker config key=value (shorthand, repeatable)")
+	flagset.StringVar(&flagRecord, "record", "", "record requests, their responses and client IDs to file as JSON Lines, empty to disable")
+	flagset.StringVar(&flagDataDir, "data-dir", "", "persist cluster state to dir on shutdown and restore it on start, empty to disable")
+	flagset.DurationVar(&flagInterval, "snapshot-interval", 0, "also snapshot to -data-dir on this interval, 0 to disable")
+	flagset.StringVar(&flagReadyFile, "ready-file", "", "write bootstrap servers, version, topics and ports as JSON to file once ready, empty to disable")
+	flagset.StringVar(&flagHealth, "health-addr", "", "serve /healthz on addr (e.g. :8080), empty to disable")
+	flagset.StringVar(&flagRegistry, "schema-registry", "", "serve a schema registry stand-in on addr (e.g. :8081), empty to disable")
+	flagset.StringVar(&flagSchemaDir, "schema-dir", "", "seed the schema registry from *.avsc, *.proto and *.json files in dir")
 
 	if err := flagset.Parse(osargs[1:]); err != nil {
 		return err
 	}
 
-	ports, err := parsePorts(flagPorts)
-	if err != nil {
-		return err
-	}
+	var snap *snapshot
+	if flagDataDir != "" {
+		var err error
+		snap, err = loadSnapshot(flagDataDir)
+		if err != nil {
+			return fmt.Errorf("load snapshot: %w", err)
+		}
 
-	seedTopics := parseCSV(flagSeedTopics)
-	if len(seedTopics) == 0 {
-		seedTopics = []string{"foo"}
+		// Broker configs given on the command line win over the
+		// snapshotted ones, snapshotted topics win over seeded ones.
+		if snap != nil {
+			for k, v := range snap.BrokerConfigs {
+				if _, ok := flagCluster.bcfgs[k]; !ok {
+					flagCluster.bcfgs[k] = v
+				}
+			}
+			flagCluster.restored = make(map[string]bool)
+			for _, t := range snap.Topics {
+				flagCluster.restored[t.Topic] = true
+			}
+		}
 	}
 
-	logLevel, err := parseLogLevel(flagLogLevel)
+	flagCluster.proxied = flagRecord != ""
+
+	opts, err := flagCluster.options(stderr)
 	if err != nil {
 		return err
 	}
@@ -79,34 +113,212 @@ func realMain(ctx context.Context, osargs []string, stdout io.Writer, stderr io.
 		}()
 	}
 
+	var rec *recorder
+	if flagRecord != "" {
+		rec, err = newRecorder(flagRecord, stderr)
+		if err != nil {
+			return err
+		}
+		defer rec.Close()
+	}
+
+	cluster, err := kfake.NewCluster(opts...)
+	if err != nil {
+		return err
+	}
+	defer cluster.Close()
+
+	// Clients are given the addresses of the recording proxies, if any.
+	// Our own clients talk to the brokers directly so that they are not
+	// recorded.
+	addrs := cluster.ListenAddrs()
+	clientOpts := flagCluster.clientOpts(addrs)
+
+	if rec != nil {
+		ports, err := parsePorts(flagCluster.ports)
+		if err != nil {
+			return err
+		}
+
+		proxy, err := newRecordingProxy(rec, flagCluster.tls, ports, addrs)
+		if err != nil {
+			return err
+		}
+		defer proxy.Close()
+
+		addrs = proxy.Addrs()
+	}
+
+	if snap != nil {
+		if err := restoreSnapshot(ctx, clientOpts, snap); err != nil {
+			return fmt.Errorf("restore snapshot: %w", err)
+		}
+		fmt.Fprintf(stderr, "restored snapshot from %s\n", snap.Time.Format(time.RFC3339))
+	}
+
+	var snapshots *snapshotter
+	if flagDataDir != "" {
+		snapshots = &snapshotter{dir: flagDataDir, clientOpts: clientOpts, stderr: stderr}
+		go snapshots.run(ctx, flagInterval)
+	}
+
+	if flagRegistry != "" {
+		reg := newRegistry()
+		if flagSchemaDir != "" {
+			n, err := reg.seed(flagSchemaDir)
+			if err != nil {
+				return fmt.Errorf("seed schema registry: %w", err)
+			}
+			fmt.Fprintf(stderr, "seeded %d schemas from %s\n", n, flagSchemaDir)
+		}
+
+		addr, err := reg.serve(ctx, flagRegistry, stderr)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stderr, "schema registry listening on %s\n", addr)
+	}
+
+	if flagReadyFile != "" || flagHealth != "" {
+		ready, err := newReadiness(clientOpts, addrs, flagCluster.version)
+		if err != nil {
+			return err
+		}
+		defer ready.Close()
+
+		if flagHealth != "" {
+			addr, err := ready.serve(ctx, flagHealth, stderr)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stderr, "health listening on %s\n", addr)
+		}
+
+		if flagReadyFile != "" {
+			info, err := ready.info(ctx)
+			if err != nil {
+				return fmt.Errorf("ready: %w", err)
+			}
+			if err := writeReadyFile(flagReadyFile, info); err != nil {
+				return fmt.Errorf("ready: %w", err)
+			}
+			defer os.Remove(flagReadyFile)
+		}
+	}
+
+	fmt.Fprintln(stdout, strings.Join(addrs, ","))
+
+	<-ctx.Done()
+
+	if snapshots != nil {
+		saveCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := snapshots.save(saveCtx); err != nil {
+			return fmt.Errorf("snapshot: %w", err)
+		}
+	}
+
+	return nil
+}
+
+type clusterFlags struct {
+	logLevel   string
+	version    string
+	ports      string
+	seedTopics string
+	bcfgs      brokerConfigFlag
+	saslUsers  saslUserFlag
+	tlsDir     string
+	tlsHosts   string
+
+	// restored are the topics of a snapshot, which are not seeded so that
+	// they are created with their snapshotted partitions and configs.
+	restored map[string]bool
+
+	// proxied makes the brokers listen on free ports, -ports being the
+	// ports of the recording proxies in front of them.
+	proxied bool
+
+	// tls is generated by options when -tls-dir is set.
+	tls *tlsMaterial
+}
+
+func newClusterFlags() *clusterFlags {
+	return &clusterFlags{bcfgs: make(brokerConfigFlag)}
+}
+
+func (f *clusterFlags) register(flagset *flag.FlagSet) {
+	flagset.StringVar(&f.logLevel, "log-level", "none", "log level: none|error|warn|info|debug")
+	flagset.StringVar(&f.logLevel, "l", "none", "log level (shorthand)")
+	flagset.StringVar(&f.version, "as-version", "", "Kafka version to emulate (e.g. 2.8, 3.5)")
+	flagset.StringVar(&f.ports, "ports", "9092,9093,9094", "broker ports (comma-separated, 0 picks a free port)")
+	flagset.StringVar(&f.seedTopics, "seed-topics", "foo", "topics to seed (comma-separated)")
+	flagset.Var(f.bcfgs, "broker-config", "broker config key=value (repeatable)")
+	flagset.Var(f.bcfgs, "c", "broker config key=value (shorthand, repeatable)")
+	flagset.Var(&f.saslUsers, "sasl", "enable SASL with a mechanism:user:pass superuser, mechanism is PLAIN|SCRAM-SHA-256|SCRAM-SHA-512 (repeatable)")
+	flagset.StringVar(&f.tlsDir, "tls-dir", "", "serve TLS with a generated CA, writing ca.pem, client.pem and client-key.pem to dir, empty to disable")
+	flagset.StringVar(&f.tlsHosts, "tls-hosts", "localhost,127.0.0.1,::1", "hosts for the generated server certificate (comma-separated)")
+}
+
+func (f *clusterFlags) options(stderr io.Writer) ([]kfake.Opt, error) {
+	ports, err := parsePorts(f.ports)
+	if err != nil {
+		return nil, err
+	}
+	if f.proxied {
+		ports = make([]int, len(ports))
+	}
+
+	seedTopics := parseCSV(f.seedTopics)
+	if len(seedTopics) == 0 {
+		seedTopics = []string{"foo"}
+	}
+	seedTopics = slices.DeleteFunc(seedTopics, func(t string) bool { return f.restored[t] })
+
+	logLevel, err := parseLogLevel(f.logLevel)
+	if err != nil {
+		return nil, err
+	}
+
 	opts := []kfake.Opt{
 		kfake.Ports(ports...),
-		kfake.SeedTopics(-1, seedTopics...),
 		kfake.WithLogger(kfake.BasicLogger(stderr, logLevel)),
 	}
 
-	if flagVersion != "" {
-		v := kversion.FromString(flagVersion)
+	if len(seedTopics) > 0 {
+		opts = append(opts, kfake.SeedTopics(-1, seedTopics...))
+	}
+
+	if f.version != "" {
+		v := kversion.FromString(f.version)
 		if v == nil {
-			return fmt.Errorf("unknown version %q; valid versions: %v", flagVersion, kversion.VersionStrings())
+			return nil, fmt.Errorf("unknown version %q; valid versions: %v", f.version, kversion.VersionStrings())
 		}
 		opts = append(opts, kfake.MaxVersions(v))
 	}
 
-	if len(flagBcfgs) > 0 {
-		opts = append(opts, kfake.BrokerConfigs(flagBcfgs))
+	if len(f.bcfgs) > 0 {
+		opts = append(opts, kfake.BrokerConfigs(f.bcfgs))
 	}
 
-	cluster, err := kfake.NewCluster(opts...)
-	if err != nil {
-		return err
+	if len(f.saslUsers) > 0 {
+		opts = append(opts, kfake.EnableSASL())
+		for _, u := range f.saslUsers {
+			opts = append(opts, kfake.Superuser(u.mechanism, u.user, u.pass))
+		}
 	}
-	defer cluster.Close()
 
-	fmt.Fprintln(stdout, strings.Join(cluster.ListenAddrs(), ","))
+	if f.tlsDir != "" {
+		material, err := generateTLS(f.tlsDir, parseCSV(f.tlsHosts))
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		f.tls = material
+		opts = append(opts, kfake.TLS(material.server))
+	}
 
-	<-ctx.Done()
-	return nil
+	return opts, nil
 }
 
 type brokerConfigFlag map[string]string
@@ -168,8 +380,8 @@ func parsePorts(input string) ([]int, error) {
 		if err != nil {
 			return nil, fmt.Errorf("invalid port %q: %w", p, err)
 		}
-		if v <= 0 || v > 65535 {
-			return nil, fmt.Errorf("invalid port %d: must be between 1 and 65535", v)
+		if v < 0 || v > 65535 {
+			return nil, fmt.Errorf("invalid port %d: must be between 0 and 65535", v)
 		}
 		ports = append(ports, v)
 	}
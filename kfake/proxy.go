@@ -0,0 +1,380 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kbin"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// maxFrameSize bounds the size of a single request or response the
+// recording proxy buffers.
+const maxFrameSize = 256 << 20
+
+// recordingProxy listens in front of the brokers and forwards every
+// connection to its broker, handing each request with its response and
+// the client ID of the request header to a recorder. Broker addresses in
+// responses are rewritten to the proxy's, so clients keep talking through
+// it after bootstrapping.
+type recordingProxy struct {
+	rec *recorder
+	tls *tlsMaterial
+
+	listeners []net.Listener
+	// public maps a broker address to the address of its proxy.
+	public map[string]string
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// newRecordingProxy listens on ports, on the host of the broker with the
+// same index in upstreams, and forwards to that broker.
+func newRecordingProxy(rec *recorder, material *tlsMaterial, ports []int, upstreams []string) (*recordingProxy, error) {
+	if len(ports) != len(upstreams) {
+		return nil, fmt.Errorf("record: %d ports for %d brokers", len(ports), len(upstreams))
+	}
+
+	p := &recordingProxy{
+		rec:    rec,
+		tls:    material,
+		public: make(map[string]string),
+		conns:  make(map[net.Conn]struct{}),
+	}
+
+	for i, upstream := range upstreams {
+		host, _, err := net.SplitHostPort(upstream)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("record: %w", err)
+		}
+
+		ln, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(ports[i])))
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("record: %w", err)
+		}
+		p.listeners = append(p.listeners, ln)
+		p.public[upstream] = ln.Addr().String()
+	}
+
+	for i, ln := range p.listeners {
+		p.wg.Add(1)
+		go p.accept(ln, upstreams[i], int32(i))
+	}
+
+	return p, nil
+}
+
+// Addrs returns the addresses clients should connect to, in broker order.
+func (p *recordingProxy) Addrs() []string {
+	addrs := make([]string, 0, len(p.listeners))
+	for _, ln := range p.listeners {
+		addrs = append(addrs, ln.Addr().String())
+	}
+	return addrs
+}
+
+// Close stops accepting, closes every proxied connection and waits for
+// their last events to reach the recorder.
+func (p *recordingProxy) Close() {
+	for _, ln := range p.listeners {
+		ln.Close()
+	}
+
+	p.mu.Lock()
+	for c := range p.conns {
+		c.Close()
+	}
+	p.conns = nil
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+func (p *recordingProxy) track(c net.Conn) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conns == nil {
+		return false
+	}
+	p.conns[c] = struct{}{}
+	return true
+}
+
+func (p *recordingProxy) untrack(c net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.conns, c)
+}
+
+func (p *recordingProxy) accept(ln net.Listener, upstream string, broker int32) {
+	defer p.wg.Done()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.proxy(conn, upstream, broker)
+		}()
+	}
+}
+
+// pendingRequest is a request forwarded to a broker that has not been
+// answered yet.
+type pendingRequest struct {
+	at       time.Time
+	clientID string
+	req      kmsg.Request
+	err      error
+}
+
+func (p *recordingProxy) proxy(client net.Conn, upstream string, broker int32) {
+	if p.tls != nil {
+		client = tls.Server(client, p.tls.server)
+	}
+
+	var (
+		server net.Conn
+		err    error
+	)
+	if p.tls != nil {
+		server, err = tls.Dial("tcp", upstream, p.tls.client.Clone())
+	} else {
+		server, err = net.Dial("tcp", upstream)
+	}
+	if err != nil {
+		client.Close()
+		return
+	}
+
+	if !p.track(client) || !p.track(server) {
+		client.Close()
+		server.Close()
+		return
+	}
+	defer func() {
+		client.Close()
+		server.Close()
+		p.untrack(client)
+		p.untrack(server)
+	}()
+
+	var (
+		mu      sync.Mutex
+		pending = make(map[int32]pendingRequest)
+	)
+
+	go func() {
+		defer server.Close()
+
+		for {
+			frame, err := readFrame(client)
+			if err != nil {
+				return
+			}
+
+			corr, pr, ok := parseRequest(frame)
+			if ok {
+				if produce, isProduce := pr.req.(*kmsg.ProduceRequest); isProduce && produce.Acks == 0 {
+					// Brokers do not answer acks=0 produce requests.
+					p.rec.record(p.rec.event(broker, pr, nil, nil))
+				} else {
+					mu.Lock()
+					pending[corr] = pr
+					mu.Unlock()
+				}
+			}
+
+			if _, err := server.Write(frame); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		frame, err := readFrame(server)
+		if err != nil {
+			return
+		}
+
+		if len(frame) >= 8 {
+			corr := int32(binary.BigEndian.Uint32(frame[4:8]))
+
+			mu.Lock()
+			pr, ok := pending[corr]
+			delete(pending, corr)
+			mu.Unlock()
+
+			if ok {
+				var resp kmsg.Response
+				frame, resp, err = p.parseResponse(frame, pr.req)
+				p.rec.record(p.rec.event(broker, pr, resp, err))
+			}
+		}
+
+		if _, err := client.Write(frame); err != nil {
+			return
+		}
+	}
+}
+
+// readFrame reads a size-prefixed request or response, including the size.
+func readFrame(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxFrameSize {
+		return nil, fmt.Errorf("frame of %d bytes exceeds %d", n, maxFrameSize)
+	}
+
+	frame := make([]byte, 4+n)
+	copy(frame, size[:])
+	if _, err := io.ReadFull(r, frame[4:]); err != nil {
+		return nil, err
+	}
+
+	return frame, nil
+}
+
+// parseRequest parses the header and body of a request frame. It reports
+// false for frames that are not requests, such as raw SASL tokens.
+func parseRequest(frame []byte) (int32, pendingRequest, bool) {
+	b := kbin.Reader{Src: frame[4:]}
+	key := b.Int16()
+	version := b.Int16()
+	corr := b.Int32()
+	clientID := b.NullableString()
+	if !b.Ok() {
+		return 0, pendingRequest{}, false
+	}
+
+	req := kmsg.RequestForKey(key)
+	if req == nil || version < 0 || version > req.MaxVersion() {
+		return 0, pendingRequest{}, false
+	}
+	req.SetVersion(version)
+
+	pr := pendingRequest{at: time.Now().UTC(), req: req}
+	if clientID != nil {
+		pr.clientID = *clientID
+	}
+
+	if req.IsFlexible() {
+		skipTags(&b)
+	}
+	if err := b.Complete(); err != nil {
+		pr.err = fmt.Errorf("read request header: %w", err)
+		return corr, pr, true
+	}
+
+	if err := req.ReadFrom(b.Src); err != nil {
+		pr.err = fmt.Errorf("read request: %w", err)
+	}
+
+	return corr, pr, true
+}
+
+// parseResponse parses a response frame to req, rewriting broker
+// addresses to the proxy's. It returns the frame to forward.
+func (p *recordingProxy) parseResponse(frame []byte, req kmsg.Request) ([]byte, kmsg.Response, error) {
+	b := kbin.Reader{Src: frame[8:]}
+	// ApiVersions responses always use the first header version so that
+	// clients can parse them before knowing what the broker supports.
+	if req.IsFlexible() && req.Key() != kmsg.ApiVersions.Int16() {
+		skipTags(&b)
+	}
+	if err := b.Complete(); err != nil {
+		return frame, nil, fmt.Errorf("read response header: %w", err)
+	}
+	header := frame[:len(frame)-len(b.Src)]
+
+	resp := req.ResponseKind()
+	resp.SetVersion(req.GetVersion())
+	if err := resp.ReadFrom(b.Src); err != nil {
+		return frame, nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if !p.rewriteAddrs(resp) {
+		return frame, resp, nil
+	}
+
+	rewritten := resp.AppendTo(append([]byte(nil), header...))
+	binary.BigEndian.PutUint32(rewritten, uint32(len(rewritten)-4))
+
+	return rewritten, resp, nil
+}
+
+// rewriteAddrs replaces the broker addresses in resp with the addresses
+// of their proxies, reporting whether any changed.
+func (p *recordingProxy) rewriteAddrs(resp kmsg.Response) bool {
+	var changed bool
+	rewrite := func(host *string, port *int32) {
+		public, ok := p.public[net.JoinHostPort(*host, strconv.Itoa(int(*port)))]
+		if !ok {
+			return
+		}
+		h, ps, err := net.SplitHostPort(public)
+		if err != nil {
+			return
+		}
+		n, err := strconv.Atoi(ps)
+		if err != nil {
+			return
+		}
+		*host, *port = h, int32(n)
+		changed = true
+	}
+
+	switch resp := resp.(type) {
+	case *kmsg.MetadataResponse:
+		for i := range resp.Brokers {
+			rewrite(&resp.Brokers[i].Host, &resp.Brokers[i].Port)
+		}
+	case *kmsg.FindCoordinatorResponse:
+		rewrite(&resp.Host, &resp.Port)
+		for i := range resp.Coordinators {
+			rewrite(&resp.Coordinators[i].Host, &resp.Coordinators[i].Port)
+		}
+	case *kmsg.DescribeClusterResponse:
+		for i := range resp.Brokers {
+			rewrite(&resp.Brokers[i].Host, &resp.Brokers[i].Port)
+		}
+	case *kmsg.ProduceResponse:
+		for i := range resp.Brokers {
+			rewrite(&resp.Brokers[i].Host, &resp.Brokers[i].Port)
+		}
+	case *kmsg.FetchResponse:
+		for i := range resp.Brokers {
+			rewrite(&resp.Brokers[i].Host, &resp.Brokers[i].Port)
+		}
+	}
+
+	return changed
+}
+
+// skipTags skips the tagged fields of a flexible header.
+func skipTags(b *kbin.Reader) {
+	for n := b.Uvarint(); n > 0; n-- {
+		b.Uvarint()
+		b.Span(int(b.Uvarint()))
+	}
+}
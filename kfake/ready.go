@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// readyInfo is what -ready-file and /healthz report once the cluster is
+// serving.
+type readyInfo struct {
+	BootstrapServers []string `json:"bootstrap_servers"`
+	Ports            []int    `json:"ports"`
+	Version          string   `json:"version"`
+	Topics           []string `json:"topics"`
+	HealthAddr       string   `json:"health_addr,omitempty"`
+}
+
+// readiness answers health checks by asking the cluster for metadata with
+// the tool's own client.
+type readiness struct {
+	client     *kgo.Client
+	addrs      []string
+	version    string
+	healthAddr string
+}
+
+func newReadiness(clientOpts []kgo.Opt, addrs []string, version string) (*readiness, error) {
+	client, err := kgo.NewClient(clientOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if version == "" {
+		version = "latest"
+	}
+
+	return &readiness{client: client, addrs: addrs, version: version}, nil
+}
+
+func (r *readiness) Close() {
+	r.client.Close()
+}
+
+func (r *readiness) info(ctx context.Context) (*readyInfo, error) {
+	info := &readyInfo{
+		BootstrapServers: r.addrs,
+		Version:          r.version,
+		Topics:           []string{},
+		HealthAddr:       r.healthAddr,
+	}
+
+	for _, addr := range r.addrs {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, err
+		}
+		info.Ports = append(info.Ports, p)
+	}
+
+	meta, err := kmsg.NewPtrMetadataRequest().RequestWith(ctx, r.client)
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+
+	for _, t := range meta.Topics {
+		if t.Topic != nil && !t.IsInternal {
+			info.Topics = append(info.Topics, *t.Topic)
+		}
+	}
+	sort.Strings(info.Topics)
+
+	return info, nil
+}
+
+// serve starts the /healthz endpoint on addr. It answers 200 with the
+// readyInfo while the cluster responds to metadata requests and 503
+// otherwise.
+func (r *readiness) serve(ctx context.Context, addr string, stderr io.Writer) (net.Addr, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("health: %w", err)
+	}
+	r.healthAddr = ln.Addr().String()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, req *http.Request) {
+		reqCtx, cancel := context.WithTimeout(req.Context(), 5*time.Second)
+		defer cancel()
+
+		w.Header().Set("Content-Type", "application/json")
+
+		info, err := r.info(reqCtx)
+		if err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(info)
+	})
+
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(stderr, "health failed: %v\n", err)
+		}
+	}()
+
+	return ln.Addr(), nil
+}
+
+// writeReadyFile writes info to path through a temporary file, so a
+// harness polling for the file never reads it half-written.
+func writeReadyFile(path string, info *readyInfo) error {
+	b, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
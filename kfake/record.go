@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// recordedEvent is a single line of a -record file.
+type recordedEvent struct {
+	Time     time.Time       `json:"time"`
+	Broker   int32           `json:"broker"`
+	ClientID string          `json:"client_id,omitempty"`
+	API      string          `json:"api"`
+	Key      int16           `json:"key"`
+	Version  int16           `json:"version"`
+	Topics   []recordedTopic `json:"topics,omitempty"`
+	// Response is the broker's response, without the record batches of
+	// fetch responses. It is absent for acks=0 produce requests, which
+	// are not answered.
+	Response any    `json:"response,omitempty"`
+	Error    string `json:"error,omitempty"`
+	topicID  map[[16]byte]int
+}
+
+type recordedTopic struct {
+	Topic      string              `json:"topic"`
+	TopicID    string              `json:"topic_id,omitempty"`
+	Partitions []recordedPartition `json:"partitions,omitempty"`
+}
+
+type recordedPartition struct {
+	Partition  int32            `json:"partition"`
+	NumRecords int              `json:"num_records,omitempty"`
+	Bytes      int              `json:"bytes,omitempty"`
+	Records    []recordedRecord `json:"records,omitempty"`
+}
+
+type recordedRecord struct {
+	Key       []byte           `json:"key,omitempty"`
+	Value     []byte           `json:"value,omitempty"`
+	Headers   []recordedHeader `json:"headers,omitempty"`
+	Timestamp int64            `json:"timestamp"`
+}
+
+type recordedHeader struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value,omitempty"`
+}
+
+type recorder struct {
+	f            *os.File
+	enc          *json.Encoder
+	events       chan recordedEvent
+	done         chan struct{}
+	decompressor kgo.Decompressor
+	stderr       io.Writer
+
+	mu      sync.Mutex
+	closed  bool
+	dropped int64
+
+	// names is only used by the writer goroutine.
+	names map[[16]byte]string
+}
+
+// newRecorder creates path and starts writing the events handed to record
+// to it.
+func newRecorder(path string, stderr io.Writer) (*recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("record: %w", err)
+	}
+
+	r := &recorder{
+		f:            f,
+		enc:          json.NewEncoder(f),
+		events:       make(chan recordedEvent, 1024),
+		done:         make(chan struct{}),
+		decompressor: kgo.DefaultDecompressor(),
+		stderr:       stderr,
+		names:        make(map[[16]byte]string),
+	}
+	go r.write()
+
+	return r, nil
+}
+
+// record hands ev to the writer goroutine. It never blocks: when the
+// writer falls behind, ev is dropped and counted instead of stalling the
+// connection it was seen on.
+func (r *recorder) record(ev recordedEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return
+	}
+
+	select {
+	case r.events <- ev:
+	default:
+		r.dropped++
+	}
+}
+
+func (r *recorder) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	close(r.events)
+	dropped := r.dropped
+	r.mu.Unlock()
+
+	<-r.done
+
+	if dropped > 0 {
+		fmt.Fprintf(r.stderr, "record: dropped %d events the writer could not keep up with\n", dropped)
+	}
+
+	return r.f.Close()
+}
+
+func (r *recorder) write() {
+	defer close(r.done)
+
+	for ev := range r.events {
+		r.learnTopicIDs(ev.Response)
+		r.resolveTopicIDs(&ev)
+
+		if err := r.enc.Encode(ev); err != nil {
+			fmt.Fprintf(r.stderr, "record: %v\n", err)
+		}
+	}
+}
+
+// event describes req as seen by the proxy of broker, with its response or
+// the error parsing either of them.
+func (r *recorder) event(broker int32, pr pendingRequest, resp kmsg.Response, err error) recordedEvent {
+	req := pr.req
+	ev := recordedEvent{
+		Time:     pr.at,
+		Broker:   broker,
+		ClientID: pr.clientID,
+		API:      kmsg.NameForKey(req.Key()),
+		Key:      req.Key(),
+		Version:  req.GetVersion(),
+	}
+
+	switch {
+	case pr.err != nil:
+		ev.Error = pr.err.Error()
+	case err != nil:
+		ev.Error = err.Error()
+	}
+
+	if fetch, ok := resp.(*kmsg.FetchResponse); ok {
+		for i := range fetch.Topics {
+			for j := range fetch.Topics[i].Partitions {
+				fetch.Topics[i].Partitions[j].RecordBatches = nil
+			}
+		}
+	}
+	if resp != nil {
+		ev.Response = resp
+	}
+
+	topic := func(name string, id [16]byte) *recordedTopic {
+		ev.Topics = append(ev.Topics, recordedTopic{Topic: name})
+		t := &ev.Topics[len(ev.Topics)-1]
+		if name == "" && id != [16]byte{} {
+			if ev.topicID == nil {
+				ev.topicID = make(map[[16]byte]int)
+			}
+			ev.topicID[id] = len(ev.Topics) - 1
+			t.TopicID = hex.EncodeToString(id[:])
+		}
+		return t
+	}
+
+	switch req := req.(type) {
+	case *kmsg.ProduceRequest:
+		for _, rt := range req.Topics {
+			t := topic(rt.Topic, rt.TopicID)
+			for _, rp := range rt.Partitions {
+				p := recordedPartition{Partition: rp.Partition, Bytes: len(rp.Records)}
+				records, err := r.decode(rp.Records)
+				if err != nil {
+					ev.Error = err.Error()
+				}
+				p.NumRecords = len(records)
+				p.Records = records
+				t.Partitions = append(t.Partitions, p)
+			}
+		}
+	case *kmsg.FetchRequest:
+		for _, rt := range req.Topics {
+			t := topic(rt.Topic, rt.TopicID)
+			for _, rp := range rt.Partitions {
+				t.Partitions = append(t.Partitions, recordedPartition{Partition: rp.Partition})
+			}
+		}
+	case *kmsg.ListOffsetsRequest:
+		for _, rt := range req.Topics {
+			t := topic(rt.Topic, [16]byte{})
+			for _, rp := range rt.Partitions {
+				t.Partitions = append(t.Partitions, recordedPartition{Partition: rp.Partition})
+			}
+		}
+	case *kmsg.OffsetCommitRequest:
+		for _, rt := range req.Topics {
+			t := topic(rt.Topic, [16]byte{})
+			for _, rp := range rt.Partitions {
+				t.Partitions = append(t.Partitions, recordedPartition{Partition: rp.Partition})
+			}
+		}
+	case *kmsg.OffsetFetchRequest:
+		for _, rt := range req.Topics {
+			t := topic(rt.Topic, [16]byte{})
+			for _, p := range rt.Partitions {
+				t.Partitions = append(t.Partitions, recordedPartition{Partition: p})
+			}
+		}
+	case *kmsg.MetadataRequest:
+		for _, rt := range req.Topics {
+			var name string
+			if rt.Topic != nil {
+				name = *rt.Topic
+			}
+			topic(name, rt.TopicID)
+		}
+	case *kmsg.CreateTopicsRequest:
+		for _, rt := range req.Topics {
+			topic(rt.Topic, [16]byte{})
+		}
+	case *kmsg.DeleteTopicsRequest:
+		for _, name := range req.TopicNames {
+			topic(name, [16]byte{})
+		}
+		for _, rt := range req.Topics {
+			var name string
+			if rt.Topic != nil {
+				name = *rt.Topic
+			}
+			topic(name, rt.TopicID)
+		}
+	}
+
+	return ev
+}
+
+// decode splits raw into record batches and returns every record in them.
+func (r *recorder) decode(raw []byte) ([]recordedRecord, error) {
+	var out []recordedRecord
+
+	for len(raw) > 0 {
+		if len(raw) < 12 {
+			return out, fmt.Errorf("short record batch: %d bytes", len(raw))
+		}
+
+		n := 12 + int(binary.BigEndian.Uint32(raw[8:12]))
+		if n > len(raw) {
+			return out, fmt.Errorf("record batch length %d exceeds %d bytes", n, len(raw))
+		}
+
+		var batch kmsg.RecordBatch
+		if err := batch.ReadFrom(raw[:n]); err != nil {
+			return out, fmt.Errorf("read record batch: %w", err)
+		}
+		raw = raw[n:]
+
+		records := batch.Records
+		if codec := kgo.CompressionCodecType(batch.Attributes & 0x07); codec != kgo.CodecNone {
+			decompressed, err := r.decompressor.Decompress(records, codec)
+			if err != nil {
+				return out, fmt.Errorf("decompress record batch: %w", err)
+			}
+			records = decompressed
+		}
+
+		for i := int32(0); i < batch.NumRecords; i++ {
+			length, m := binary.Varint(records)
+			if m <= 0 || m+int(length) > len(records) {
+				return out, fmt.Errorf("truncated record %d in batch", i)
+			}
+
+			var rec kmsg.Record
+			if err := rec.ReadFrom(records[:m+int(length)]); err != nil {
+				return out, fmt.Errorf("read record: %w", err)
+			}
+			records = records[m+int(length):]
+
+			rr := recordedRecord{
+				Key:       rec.Key,
+				Value:     rec.Value,
+				Timestamp: batch.FirstTimestamp + rec.TimestampDelta64,
+			}
+			for _, h := range rec.Headers {
+				rr.Headers = append(rr.Headers, recordedHeader{Key: h.Key, Value: h.Value})
+			}
+			out = append(out, rr)
+		}
+	}
+
+	return out, nil
+}
+
+// learnTopicIDs remembers the topic names of the IDs in metadata and
+// create topics responses.
+func (r *recorder) learnTopicIDs(resp any) {
+	switch resp := resp.(type) {
+	case *kmsg.MetadataResponse:
+		for _, t := range resp.Topics {
+			if t.Topic != nil && t.TopicID != [16]byte{} {
+				r.names[t.TopicID] = *t.Topic
+			}
+		}
+	case *kmsg.CreateTopicsResponse:
+		for _, t := range resp.Topics {
+			if t.TopicID != [16]byte{} {
+				r.names[t.TopicID] = t.Topic
+			}
+		}
+	}
+}
+
+// resolveTopicIDs fills in topic names for requests that only carry topic
+// IDs (produce and fetch v13+) from the metadata and create topics
+// responses recorded before them. Clients look topics up before producing
+// to or fetching from them, so IDs are only left unresolved for clients
+// that learned them before the recording started.
+func (r *recorder) resolveTopicIDs(ev *recordedEvent) {
+	for id, i := range ev.topicID {
+		if name, ok := r.names[id]; ok {
+			ev.Topics[i].Topic = name
+		}
+	}
+}
+
+// readRecording decodes every event of a -record file.
+func readRecording(path string) ([]recordedEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []recordedEvent
+	dec := json.NewDecoder(f)
+	for {
+		var ev recordedEvent
+		if err := dec.Decode(&ev); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		events = append(events, ev)
+	}
+
+	return events, nil
+}
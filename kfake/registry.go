@@ -0,0 +1,888 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// registry is an in-memory stand-in for a Confluent-compatible schema
+// registry. It implements the subject, version, schema-by-ID, config and
+// compatibility endpoints that serializers use.
+//
+// Compatibility is only checked for AVRO schemas; JSON and PROTOBUF schemas
+// are accepted as long as they are non-empty (and, for JSON, valid JSON).
+type registry struct {
+	mu            sync.Mutex
+	nextID        int
+	schemas       map[int]*registrySchema
+	subjects      map[string][]*registryVersion
+	compatibility string
+	subjectCompat map[string]string
+}
+
+type registrySchema struct {
+	ID         int                 `json:"id"`
+	Schema     string              `json:"schema"`
+	SchemaType string              `json:"schemaType,omitempty"`
+	References []registryReference `json:"references,omitempty"`
+}
+
+type registryReference struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+type registryVersion struct {
+	version int
+	schema  *registrySchema
+	deleted bool
+}
+
+// rawSchema is a response body written as is rather than encoded as JSON.
+type rawSchema string
+
+// schemaBody returns the body of the endpoints returning only the schema:
+// the schema itself for JSON-based AVRO and JSON schemas, and its text for
+// PROTOBUF schemas, which are not JSON.
+func schemaBody(s *registrySchema) any {
+	if s.SchemaType == schemaTypeProtobuf {
+		return rawSchema(s.Schema)
+	}
+	return json.RawMessage(s.Schema)
+}
+
+const (
+	schemaTypeAvro     = "AVRO"
+	schemaTypeJSON     = "JSON"
+	schemaTypeProtobuf = "PROTOBUF"
+)
+
+var compatibilityLevels = []string{
+	"NONE",
+	"BACKWARD",
+	"BACKWARD_TRANSITIVE",
+	"FORWARD",
+	"FORWARD_TRANSITIVE",
+	"FULL",
+	"FULL_TRANSITIVE",
+}
+
+// registryError is a Confluent-style error body with the HTTP status it is
+// sent with.
+type registryError struct {
+	status  int
+	Code    int    `json:"error_code"`
+	Message string `json:"message"`
+}
+
+func (e *registryError) Error() string { return e.Message }
+
+var (
+	errSubjectNotFound = &registryError{status: http.StatusNotFound, Code: 40401, Message: "Subject not found."}
+	errVersionNotFound = &registryError{status: http.StatusNotFound, Code: 40402, Message: "Version not found."}
+	errSchemaNotFound  = &registryError{status: http.StatusNotFound, Code: 40403, Message: "Schema not found."}
+)
+
+func errInvalidSchema(err error) *registryError {
+	return &registryError{status: http.StatusUnprocessableEntity, Code: 42201, Message: "Invalid schema: " + err.Error()}
+}
+
+func errInvalidVersion(v string) *registryError {
+	return &registryError{status: http.StatusUnprocessableEntity, Code: 42202, Message: fmt.Sprintf("The specified version '%s' is not a valid version id.", v)}
+}
+
+func errInvalidCompatibility(level string) *registryError {
+	return &registryError{status: http.StatusUnprocessableEntity, Code: 42203, Message: fmt.Sprintf("Invalid compatibility level %q.", level)}
+}
+
+func errIncompatible(err error) *registryError {
+	return &registryError{status: http.StatusConflict, Code: 409, Message: "Schema being registered is incompatible with an earlier schema: " + err.Error()}
+}
+
+func newRegistry() *registry {
+	return &registry{
+		nextID:        1,
+		schemas:       make(map[int]*registrySchema),
+		subjects:      make(map[string][]*registryVersion),
+		compatibility: "BACKWARD",
+		subjectCompat: make(map[string]string),
+	}
+}
+
+// seed registers every schema file in dir. The subject is the file name
+// without its extension, and the extension picks the schema type: .avsc
+// for AVRO, .proto for PROTOBUF and .json for JSON. Files are registered
+// in name order so IDs are stable across restarts.
+func (r *registry) seed(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		ext := filepath.Ext(e.Name())
+		var schemaType string
+		switch ext {
+		case ".avsc":
+			schemaType = schemaTypeAvro
+		case ".proto":
+			schemaType = schemaTypeProtobuf
+		case ".json":
+			schemaType = schemaTypeJSON
+		default:
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return n, err
+		}
+
+		subject := strings.TrimSuffix(e.Name(), ext)
+		if _, err := r.register(subject, registrySchema{Schema: string(b), SchemaType: schemaType}); err != nil {
+			return n, fmt.Errorf("%s: %w", e.Name(), err)
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// register adds s as the next version of subject, returning the ID of an
+// identical schema if one is already registered. r.mu must be held.
+func (r *registry) register(subject string, s registrySchema) (int, error) {
+	if s.SchemaType == "" {
+		s.SchemaType = schemaTypeAvro
+	}
+
+	canonical, err := canonicalSchema(s)
+	if err != nil {
+		return 0, errInvalidSchema(err)
+	}
+	s.Schema = canonical
+
+	versions := r.liveVersions(subject)
+	for _, v := range versions {
+		if sameSchema(v.schema, &s) {
+			return v.schema.ID, nil
+		}
+	}
+
+	if err := r.checkCompatibility(subject, &s, versions); err != nil {
+		return 0, errIncompatible(err)
+	}
+
+	schema := r.lookupSchema(&s)
+	if schema == nil {
+		schema = &s
+		schema.ID = r.nextID
+		r.nextID++
+		r.schemas[schema.ID] = schema
+	}
+
+	next := 1
+	if all := r.subjects[subject]; len(all) > 0 {
+		next = all[len(all)-1].version + 1
+	}
+	r.subjects[subject] = append(r.subjects[subject], &registryVersion{version: next, schema: schema})
+
+	return schema.ID, nil
+}
+
+func (r *registry) lookupSchema(s *registrySchema) *registrySchema {
+	for _, existing := range r.schemas {
+		if sameSchema(existing, s) {
+			return existing
+		}
+	}
+	return nil
+}
+
+func sameSchema(a, b *registrySchema) bool {
+	if a.Schema != b.Schema || a.SchemaType != b.SchemaType || len(a.References) != len(b.References) {
+		return false
+	}
+	for i := range a.References {
+		if a.References[i] != b.References[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// canonicalSchema validates s and returns its schema in a form suitable for
+// comparing with other schemas.
+func canonicalSchema(s registrySchema) (string, error) {
+	switch s.SchemaType {
+	case schemaTypeAvro, schemaTypeJSON:
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, []byte(s.Schema)); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	case schemaTypeProtobuf:
+		if strings.TrimSpace(s.Schema) == "" {
+			return "", errors.New("empty schema")
+		}
+		return s.Schema, nil
+	default:
+		return "", fmt.Errorf("unknown schema type %q", s.SchemaType)
+	}
+}
+
+func (r *registry) liveVersions(subject string) []*registryVersion {
+	var live []*registryVersion
+	for _, v := range r.subjects[subject] {
+		if !v.deleted {
+			live = append(live, v)
+		}
+	}
+	return live
+}
+
+func (r *registry) subjectCompatibility(subject string) string {
+	if level, ok := r.subjectCompat[subject]; ok {
+		return level
+	}
+	return r.compatibility
+}
+
+// checkCompatibility checks s against the live versions of subject
+// according to the subject's compatibility level.
+func (r *registry) checkCompatibility(subject string, s *registrySchema, versions []*registryVersion) error {
+	level := r.subjectCompatibility(subject)
+	if level == "NONE" || len(versions) == 0 {
+		return nil
+	}
+
+	if !strings.HasSuffix(level, "_TRANSITIVE") {
+		versions = versions[len(versions)-1:]
+	}
+	level = strings.TrimSuffix(level, "_TRANSITIVE")
+
+	for _, v := range versions {
+		if v.schema.SchemaType != s.SchemaType {
+			return fmt.Errorf("schema type %s does not match %s of version %d", s.SchemaType, v.schema.SchemaType, v.version)
+		}
+
+		if s.SchemaType != schemaTypeAvro {
+			continue
+		}
+
+		if level == "BACKWARD" || level == "FULL" {
+			if err := avroCompatible(s.Schema, v.schema.Schema); err != nil {
+				return fmt.Errorf("new schema cannot read data written with version %d: %w", v.version, err)
+			}
+		}
+		if level == "FORWARD" || level == "FULL" {
+			if err := avroCompatible(v.schema.Schema, s.Schema); err != nil {
+				return fmt.Errorf("version %d cannot read data written with new schema: %w", v.version, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *registry) version(subject, version string) (*registryVersion, error) {
+	versions := r.liveVersions(subject)
+	if len(versions) == 0 {
+		return nil, errSubjectNotFound
+	}
+
+	if version == "latest" || version == "-1" {
+		return versions[len(versions)-1], nil
+	}
+
+	n, err := strconv.Atoi(version)
+	if err != nil || n <= 0 {
+		return nil, errInvalidVersion(version)
+	}
+
+	for _, v := range versions {
+		if v.version == n {
+			return v, nil
+		}
+	}
+
+	return nil, errVersionNotFound
+}
+
+func (r *registry) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	handle := func(pattern string, fn func(req *http.Request) (any, error)) {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+
+			r.mu.Lock()
+			body, err := fn(req)
+			r.mu.Unlock()
+
+			if raw, ok := body.(rawSchema); ok && err == nil {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				_, _ = io.WriteString(w, string(raw))
+				return
+			}
+
+			// Encode before writing the header so that a body failing to
+			// encode is answered with an error instead of a truncated 200.
+			var buf bytes.Buffer
+			if err == nil {
+				err = json.NewEncoder(&buf).Encode(body)
+			}
+
+			if err != nil {
+				var rerr *registryError
+				if !errors.As(err, &rerr) {
+					rerr = &registryError{status: http.StatusInternalServerError, Code: 50001, Message: err.Error()}
+				}
+				buf.Reset()
+				_ = json.NewEncoder(&buf).Encode(rerr)
+				w.WriteHeader(rerr.status)
+			}
+
+			_, _ = w.Write(buf.Bytes())
+		})
+	}
+
+	decode := func(req *http.Request) (registrySchema, error) {
+		var s registrySchema
+		if err := json.NewDecoder(req.Body).Decode(&s); err != nil {
+			return s, errInvalidSchema(err)
+		}
+		if s.SchemaType == "" {
+			s.SchemaType = schemaTypeAvro
+		}
+		canonical, err := canonicalSchema(s)
+		if err != nil {
+			return s, errInvalidSchema(err)
+		}
+		s.Schema = canonical
+		return s, nil
+	}
+
+	versionBody := func(subject string, v *registryVersion) any {
+		return struct {
+			Subject string `json:"subject"`
+			Version int    `json:"version"`
+			*registrySchema
+		}{subject, v.version, v.schema}
+	}
+
+	handle("GET /subjects", func(req *http.Request) (any, error) {
+		subjects := []string{}
+		for s := range r.subjects {
+			if len(r.liveVersions(s)) > 0 {
+				subjects = append(subjects, s)
+			}
+		}
+		sort.Strings(subjects)
+		return subjects, nil
+	})
+
+	handle("GET /subjects/{subject}/versions", func(req *http.Request) (any, error) {
+		versions := r.liveVersions(req.PathValue("subject"))
+		if len(versions) == 0 {
+			return nil, errSubjectNotFound
+		}
+		out := make([]int, 0, len(versions))
+		for _, v := range versions {
+			out = append(out, v.version)
+		}
+		return out, nil
+	})
+
+	handle("GET /subjects/{subject}/versions/{version}", func(req *http.Request) (any, error) {
+		subject := req.PathValue("subject")
+		v, err := r.version(subject, req.PathValue("version"))
+		if err != nil {
+			return nil, err
+		}
+		return versionBody(subject, v), nil
+	})
+
+	handle("GET /subjects/{subject}/versions/{version}/schema", func(req *http.Request) (any, error) {
+		v, err := r.version(req.PathValue("subject"), req.PathValue("version"))
+		if err != nil {
+			return nil, err
+		}
+		return schemaBody(v.schema), nil
+	})
+
+	handle("POST /subjects/{subject}/versions", func(req *http.Request) (any, error) {
+		s, err := decode(req)
+		if err != nil {
+			return nil, err
+		}
+
+		id, err := r.register(req.PathValue("subject"), s)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]int{"id": id}, nil
+	})
+
+	handle("POST /subjects/{subject}", func(req *http.Request) (any, error) {
+		subject := req.PathValue("subject")
+		s, err := decode(req)
+		if err != nil {
+			return nil, err
+		}
+
+		versions := r.liveVersions(subject)
+		if len(versions) == 0 {
+			return nil, errSubjectNotFound
+		}
+		for _, v := range versions {
+			if sameSchema(v.schema, &s) {
+				return versionBody(subject, v), nil
+			}
+		}
+		return nil, errSchemaNotFound
+	})
+
+	handle("DELETE /subjects/{subject}", func(req *http.Request) (any, error) {
+		versions := r.liveVersions(req.PathValue("subject"))
+		if len(versions) == 0 {
+			return nil, errSubjectNotFound
+		}
+		out := make([]int, 0, len(versions))
+		for _, v := range versions {
+			v.deleted = true
+			out = append(out, v.version)
+		}
+		return out, nil
+	})
+
+	handle("DELETE /subjects/{subject}/versions/{version}", func(req *http.Request) (any, error) {
+		v, err := r.version(req.PathValue("subject"), req.PathValue("version"))
+		if err != nil {
+			return nil, err
+		}
+		v.deleted = true
+		return v.version, nil
+	})
+
+	handle("GET /schemas/ids/{id}", func(req *http.Request) (any, error) {
+		id, err := strconv.Atoi(req.PathValue("id"))
+		if err != nil {
+			return nil, errSchemaNotFound
+		}
+		s, ok := r.schemas[id]
+		if !ok {
+			return nil, errSchemaNotFound
+		}
+		return struct {
+			Schema     string              `json:"schema"`
+			SchemaType string              `json:"schemaType,omitempty"`
+			References []registryReference `json:"references,omitempty"`
+		}{s.Schema, s.SchemaType, s.References}, nil
+	})
+
+	handle("GET /schemas/ids/{id}/schema", func(req *http.Request) (any, error) {
+		id, err := strconv.Atoi(req.PathValue("id"))
+		if err != nil {
+			return nil, errSchemaNotFound
+		}
+		s, ok := r.schemas[id]
+		if !ok {
+			return nil, errSchemaNotFound
+		}
+		return schemaBody(s), nil
+	})
+
+	handle("GET /schemas/types", func(req *http.Request) (any, error) {
+		return []string{schemaTypeAvro, schemaTypeJSON, schemaTypeProtobuf}, nil
+	})
+
+	handle("POST /compatibility/subjects/{subject}/versions/{version}", func(req *http.Request) (any, error) {
+		subject := req.PathValue("subject")
+		s, err := decode(req)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := r.version(subject, req.PathValue("version"))
+		if err != nil {
+			return nil, err
+		}
+
+		err = r.checkCompatibility(subject, &s, []*registryVersion{v})
+		body := struct {
+			IsCompatible bool     `json:"is_compatible"`
+			Messages     []string `json:"messages,omitempty"`
+		}{IsCompatible: err == nil}
+		if err != nil && req.URL.Query().Get("verbose") == "true" {
+			body.Messages = []string{err.Error()}
+		}
+		return body, nil
+	})
+
+	type compatibilityBody struct {
+		Compatibility      string `json:"compatibility,omitempty"`
+		CompatibilityLevel string `json:"compatibilityLevel,omitempty"`
+	}
+
+	setCompatibility := func(req *http.Request, set func(string)) (any, error) {
+		var body compatibilityBody
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			return nil, errInvalidCompatibility("")
+		}
+		level := strings.ToUpper(body.Compatibility)
+		if !slices.Contains(compatibilityLevels, level) {
+			return nil, errInvalidCompatibility(body.Compatibility)
+		}
+		set(level)
+		return compatibilityBody{Compatibility: level}, nil
+	}
+
+	handle("GET /config", func(req *http.Request) (any, error) {
+		return compatibilityBody{CompatibilityLevel: r.compatibility}, nil
+	})
+
+	handle("PUT /config", func(req *http.Request) (any, error) {
+		return setCompatibility(req, func(level string) { r.compatibility = level })
+	})
+
+	handle("GET /config/{subject}", func(req *http.Request) (any, error) {
+		return compatibilityBody{CompatibilityLevel: r.subjectCompatibility(req.PathValue("subject"))}, nil
+	})
+
+	handle("PUT /config/{subject}", func(req *http.Request) (any, error) {
+		subject := req.PathValue("subject")
+		return setCompatibility(req, func(level string) { r.subjectCompat[subject] = level })
+	})
+
+	return mux
+}
+
+// serve starts the registry on addr and stops it when ctx is done.
+func (r *registry) serve(ctx context.Context, addr string, stderr io.Writer) (net.Addr, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("schema registry: %w", err)
+	}
+
+	srv := &http.Server{Handler: r.handler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(stderr, "schema registry failed: %v\n", err)
+		}
+	}()
+
+	return ln.Addr(), nil
+}
+
+// avroCompatible reports whether data written with the writer schema can be
+// read with the reader schema, following the Avro schema resolution rules.
+func avroCompatible(reader, writer string) error {
+	var r, w any
+	if err := json.Unmarshal([]byte(reader), &r); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(writer), &w); err != nil {
+		return err
+	}
+
+	r, w = qualifyAvroNames(r, ""), qualifyAvroNames(w, "")
+
+	c := &avroChecker{
+		readerNames: make(map[string]any),
+		writerNames: make(map[string]any),
+		seen:        make(map[[2]string]bool),
+	}
+	collectAvroNames(r, "", c.readerNames)
+	collectAvroNames(w, "", c.writerNames)
+
+	return c.check(r, w, "")
+}
+
+type avroChecker struct {
+	readerNames map[string]any
+	writerNames map[string]any
+	// seen breaks recursion on self-referencing named types.
+	seen map[[2]string]bool
+}
+
+// avroComplexTypes are the type names that define a type rather than
+// reference one.
+var avroComplexTypes = []string{"record", "error", "enum", "fixed", "array", "map"}
+
+var avroPrimitiveTypes = []string{"null", "boolean", "int", "long", "float", "double", "bytes", "string"}
+
+// qualifyAvroNames returns s with every reference to a named type replaced
+// by its full name, resolved in the namespace the reference is in.
+func qualifyAvroNames(s any, namespace string) any {
+	switch s := s.(type) {
+	case string:
+		if namespace == "" || strings.Contains(s, ".") || slices.Contains(avroPrimitiveTypes, s) {
+			return s
+		}
+		return namespace + "." + s
+	case []any:
+		out := make([]any, len(s))
+		for i, b := range s {
+			out[i] = qualifyAvroNames(b, namespace)
+		}
+		return out
+	case map[string]any:
+		out := maps.Clone(s)
+		switch typ, _ := s["type"].(string); typ {
+		case "record", "error", "enum", "fixed":
+			name := avroFullName(s, namespace)
+			if i := strings.LastIndex(name, "."); i >= 0 {
+				namespace = name[:i]
+			}
+		}
+		if fields, ok := s["fields"].([]any); ok {
+			qualified := make([]any, len(fields))
+			for i, f := range fields {
+				if f, ok := f.(map[string]any); ok {
+					qf := maps.Clone(f)
+					qf["type"] = qualifyAvroNames(f["type"], namespace)
+					qualified[i] = qf
+					continue
+				}
+				qualified[i] = f
+			}
+			out["fields"] = qualified
+		}
+		if items, ok := s["items"]; ok {
+			out["items"] = qualifyAvroNames(items, namespace)
+		}
+		if values, ok := s["values"]; ok {
+			out["values"] = qualifyAvroNames(values, namespace)
+		}
+		if t, ok := s["type"].(string); !ok || !slices.Contains(avroComplexTypes, t) {
+			out["type"] = qualifyAvroNames(s["type"], namespace)
+		}
+		return out
+	}
+	return s
+}
+
+func collectAvroNames(s any, namespace string, names map[string]any) {
+	switch s := s.(type) {
+	case []any:
+		for _, b := range s {
+			collectAvroNames(b, namespace, names)
+		}
+	case map[string]any:
+		typ, _ := s["type"].(string)
+		switch typ {
+		case "record", "error", "enum", "fixed":
+			name := avroFullName(s, namespace)
+			names[name] = s
+			if i := strings.LastIndex(name, "."); i >= 0 {
+				namespace = name[:i]
+			}
+		}
+		if fields, ok := s["fields"].([]any); ok {
+			for _, f := range fields {
+				if f, ok := f.(map[string]any); ok {
+					collectAvroNames(f["type"], namespace, names)
+				}
+			}
+		}
+		if items, ok := s["items"]; ok {
+			collectAvroNames(items, namespace, names)
+		}
+		if values, ok := s["values"]; ok {
+			collectAvroNames(values, namespace, names)
+		}
+		if _, ok := s["type"].(string); !ok {
+			collectAvroNames(s["type"], namespace, names)
+		}
+	}
+}
+
+func avroFullName(s map[string]any, namespace string) string {
+	name, _ := s["name"].(string)
+	if strings.Contains(name, ".") {
+		return name
+	}
+	if ns, ok := s["namespace"].(string); ok {
+		namespace = ns
+	}
+	if namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+// avroType resolves s to its type name and, for complex and named types,
+// its definition. Names must have been qualified with qualifyAvroNames.
+func avroType(s any, names map[string]any) (string, map[string]any) {
+	switch s := s.(type) {
+	case string:
+		def, ok := names[s].(map[string]any)
+		if !ok {
+			// A name used in a namespace can also refer to a type
+			// without a namespace.
+			if i := strings.LastIndex(s, "."); i >= 0 {
+				def, ok = names[s[i+1:]].(map[string]any)
+			}
+		}
+		if ok {
+			t, _ := def["type"].(string)
+			return t, def
+		}
+		return s, nil
+	case []any:
+		return "union", nil
+	case map[string]any:
+		if t, ok := s["type"].(string); ok {
+			switch t {
+			case "record", "error", "enum", "fixed", "array", "map":
+				return t, s
+			}
+			// Primitive with attributes, e.g. {"type": "string", "logicalType": ...}.
+			return avroType(t, names)
+		}
+		return avroType(s["type"], names)
+	}
+	return "", nil
+}
+
+var avroPromotions = map[string][]string{
+	"int":    {"long", "float", "double"},
+	"long":   {"float", "double"},
+	"float":  {"double"},
+	"string": {"bytes"},
+	"bytes":  {"string"},
+}
+
+func (c *avroChecker) check(reader, writer any, path string) error {
+	if wu, ok := writer.([]any); ok {
+		for _, branch := range wu {
+			if err := c.check(reader, branch, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if ru, ok := reader.([]any); ok {
+		for _, branch := range ru {
+			if c.check(branch, writer, path) == nil {
+				return nil
+			}
+		}
+		wt, _ := avroType(writer, c.writerNames)
+		return fmt.Errorf("%s: reader union has no branch for writer type %s", avroPath(path), wt)
+	}
+
+	rt, rdef := avroType(reader, c.readerNames)
+	wt, wdef := avroType(writer, c.writerNames)
+
+	if rt != wt {
+		if slices.Contains(avroPromotions[wt], rt) {
+			return nil
+		}
+		return fmt.Errorf("%s: writer type %s cannot be read as %s", avroPath(path), wt, rt)
+	}
+
+	switch rt {
+	case "record", "error":
+		key := [2]string{avroFullName(rdef, ""), avroFullName(wdef, "")}
+		if c.seen[key] {
+			return nil
+		}
+		c.seen[key] = true
+
+		writerFields := make(map[string]map[string]any)
+		if fields, ok := wdef["fields"].([]any); ok {
+			for _, f := range fields {
+				if f, ok := f.(map[string]any); ok {
+					name, _ := f["name"].(string)
+					writerFields[name] = f
+				}
+			}
+		}
+
+		fields, _ := rdef["fields"].([]any)
+		for _, f := range fields {
+			rf, ok := f.(map[string]any)
+			if !ok {
+				continue
+			}
+			name, _ := rf["name"].(string)
+
+			wf, ok := writerFields[name]
+			if !ok {
+				if _, hasDefault := rf["default"]; !hasDefault {
+					return fmt.Errorf("%s: reader field has no default and is missing from writer", avroPath(path+"."+name))
+				}
+				continue
+			}
+
+			if err := c.check(rf["type"], wf["type"], path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "enum":
+		if _, hasDefault := rdef["default"]; hasDefault {
+			return nil
+		}
+		readerSymbols, _ := rdef["symbols"].([]any)
+		writerSymbols, _ := wdef["symbols"].([]any)
+		for _, ws := range writerSymbols {
+			found := false
+			for _, rs := range readerSymbols {
+				if rs == ws {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("%s: writer enum symbol %v is missing from reader", avroPath(path), ws)
+			}
+		}
+	case "fixed":
+		if rdef["size"] != wdef["size"] {
+			return fmt.Errorf("%s: fixed size %v cannot be read as %v", avroPath(path), wdef["size"], rdef["size"])
+		}
+	case "array":
+		return c.check(rdef["items"], wdef["items"], path+"[]")
+	case "map":
+		return c.check(rdef["values"], wdef["values"], path+"{}")
+	}
+
+	return nil
+}
+
+func avroPath(path string) string {
+	if path == "" {
+		return "."
+	}
+	return path
+}
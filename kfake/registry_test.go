@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestAvroCompatible(t *testing.T) {
+	// items defines a.Item and b.Item, and field z refers to one of them
+	// by the name in its type.
+	items := func(z string) string {
+		return `{"type": "record", "name": "Outer", "namespace": "a", "fields": [
+			{"name": "x", "type": {"type": "record", "name": "Item", "fields": [{"name": "v", "type": "int"}]}},
+			{"name": "y", "type": {"type": "record", "name": "Item", "namespace": "b", "fields": [{"name": "v", "type": "string"}]}},
+			{"name": "z", "type": "` + z + `"}
+		]}`
+	}
+
+	tests := []struct {
+		name    string
+		reader  string
+		writer  string
+		wantErr string
+	}{
+		{
+			name:   "added field with default",
+			reader: `{"type": "record", "name": "R", "fields": [{"name": "a", "type": "int"}, {"name": "b", "type": "string", "default": ""}]}`,
+			writer: `{"type": "record", "name": "R", "fields": [{"name": "a", "type": "int"}]}`,
+		},
+		{
+			name:    "added field without default",
+			reader:  `{"type": "record", "name": "R", "fields": [{"name": "a", "type": "int"}, {"name": "b", "type": "string"}]}`,
+			writer:  `{"type": "record", "name": "R", "fields": [{"name": "a", "type": "int"}]}`,
+			wantErr: ".b: reader field has no default and is missing from writer",
+		},
+		{
+			name:   "promotion",
+			reader: `{"type": "array", "items": "long"}`,
+			writer: `{"type": "array", "items": "int"}`,
+		},
+		{
+			name:    "narrowing",
+			reader:  `{"type": "map", "values": "int"}`,
+			writer:  `{"type": "map", "values": "long"}`,
+			wantErr: "{}: writer type long cannot be read as int",
+		},
+		{
+			name:    "union without writer branch",
+			reader:  `["null", "string"]`,
+			writer:  `"int"`,
+			wantErr: ".: reader union has no branch for writer type int",
+		},
+		{
+			name:   "unqualified name in the enclosing namespace",
+			reader: items("Item"),
+			writer: items("a.Item"),
+		},
+		{
+			name:    "unqualified name does not match another namespace",
+			reader:  items("Item"),
+			writer:  items("b.Item"),
+			wantErr: ".z.v: writer type string cannot be read as int",
+		},
+		{
+			name: "name without namespace used in a namespace",
+			reader: `{"type": "record", "name": "R", "namespace": "n", "fields": [
+				{"name": "a", "type": {"type": "enum", "name": "E", "namespace": "", "symbols": ["X"]}},
+				{"name": "b", "type": "E"}
+			]}`,
+			writer: `{"type": "record", "name": "R", "namespace": "n", "fields": [
+				{"name": "a", "type": {"type": "enum", "name": "E", "namespace": "", "symbols": ["X"]}},
+				{"name": "b", "type": "int"}
+			]}`,
+			wantErr: ".b: writer type int cannot be read as enum",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Run repeatedly, as lookups must not depend on map order.
+			for range 20 {
+				err := avroCompatible(tt.reader, tt.writer)
+				switch {
+				case tt.wantErr == "" && err != nil:
+					t.Fatalf("avroCompatible: %v", err)
+				case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+					t.Fatalf("avroCompatible error = %v, want %q", err, tt.wantErr)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+func replayMain(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) error {
+	flagset := flag.NewFlagSet("kfake replay", flag.ExitOnError)
+	flagset.SetOutput(stderr)
+	flagset.Usage = func() {
+		fmt.Fprintf(stderr, "usage: kfake replay [options] <record-file>\n")
+		flagset.PrintDefaults()
+	}
+
+	flagCluster := newClusterFlags()
+	flagCluster.register(flagset)
+
+	if err := flagset.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if flagset.NArg() != 1 {
+		flagset.Usage()
+		return fmt.Errorf("expected exactly one record file")
+	}
+
+	events, err := readRecording(flagset.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	opts, err := flagCluster.options(stderr)
+	if err != nil {
+		return err
+	}
+
+	cluster, err := kfake.NewCluster(opts...)
+	if err != nil {
+		return err
+	}
+	defer cluster.Close()
+
+	n, err := replay(ctx, flagCluster.clientOpts(cluster.ListenAddrs()), events)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stderr, "replayed %d records\n", n)
+
+	fmt.Fprintln(stdout, strings.Join(cluster.ListenAddrs(), ","))
+
+	<-ctx.Done()
+	return nil
+}
+
+// replay creates every produced-to topic and produces the recorded records
+// to the same partitions, in the order they were recorded.
+func replay(ctx context.Context, clientOpts []kgo.Opt, events []recordedEvent) (int, error) {
+	partitions := make(map[string]int32)
+	var records []*kgo.Record
+
+	for _, ev := range events {
+		if ev.Key != kmsg.Produce.Int16() {
+			continue
+		}
+
+		for _, t := range ev.Topics {
+			if t.Topic == "" {
+				return 0, fmt.Errorf("recorded produce at %v has unresolved topic ID %s", ev.Time, t.TopicID)
+			}
+
+			for _, p := range t.Partitions {
+				partitions[t.Topic] = max(partitions[t.Topic], p.Partition+1)
+
+				for _, r := range p.Records {
+					rec := &kgo.Record{
+						Topic:     t.Topic,
+						Partition: p.Partition,
+						Key:       r.Key,
+						Value:     r.Value,
+						Timestamp: time.UnixMilli(r.Timestamp),
+					}
+					for _, h := range r.Headers {
+						rec.Headers = append(rec.Headers, kgo.RecordHeader{Key: h.Key, Value: h.Value})
+					}
+					records = append(records, rec)
+				}
+			}
+		}
+	}
+
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	client, err := kgo.NewClient(append(clientOpts, kgo.RecordPartitioner(kgo.ManualPartitioner()))...)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	req := kmsg.NewPtrCreateTopicsRequest()
+	for topic, n := range partitions {
+		t := kmsg.NewCreateTopicsRequestTopic()
+		t.Topic = topic
+		t.NumPartitions = n
+		t.ReplicationFactor = -1
+		req.Topics = append(req.Topics, t)
+	}
+
+	resp, err := req.RequestWith(ctx, client)
+	if err != nil {
+		return 0, fmt.Errorf("create topics: %w", err)
+	}
+	existing := make(map[string]int32)
+	for _, t := range resp.Topics {
+		err := kerr.ErrorForCode(t.ErrorCode)
+		switch {
+		case errors.Is(err, kerr.TopicAlreadyExists):
+			existing[t.Topic] = partitions[t.Topic]
+		case err != nil:
+			return 0, fmt.Errorf("create topic %q: %w", t.Topic, err)
+		}
+	}
+
+	if len(existing) > 0 {
+		if err := growPartitions(ctx, client, existing); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := client.ProduceSync(ctx, records...).FirstErr(); err != nil {
+		return 0, fmt.Errorf("produce: %w", err)
+	}
+
+	return len(records), nil
+}
+
+// growPartitions adds partitions to the topics with fewer than want, such
+// as topics seeded with -seed-topics, so that every recorded partition
+// exists.
+func growPartitions(ctx context.Context, client *kgo.Client, want map[string]int32) error {
+	meta := kmsg.NewPtrMetadataRequest()
+	for topic := range want {
+		t := kmsg.NewMetadataRequestTopic()
+		t.Topic = kmsg.StringPtr(topic)
+		meta.Topics = append(meta.Topics, t)
+	}
+
+	metaResp, err := meta.RequestWith(ctx, client)
+	if err != nil {
+		return fmt.Errorf("describe topics: %w", err)
+	}
+
+	req := kmsg.NewPtrCreatePartitionsRequest()
+	for _, t := range metaResp.Topics {
+		if t.Topic == nil {
+			continue
+		}
+		if err := kerr.ErrorForCode(t.ErrorCode); err != nil {
+			return fmt.Errorf("describe topic %q: %w", *t.Topic, err)
+		}
+
+		if n := want[*t.Topic]; int32(len(t.Partitions)) < n {
+			ct := kmsg.NewCreatePartitionsRequestTopic()
+			ct.Topic = *t.Topic
+			ct.Count = n
+			req.Topics = append(req.Topics, ct)
+		}
+	}
+
+	if len(req.Topics) == 0 {
+		return nil
+	}
+
+	resp, err := req.RequestWith(ctx, client)
+	if err != nil {
+		return fmt.Errorf("create partitions: %w", err)
+	}
+	for _, t := range resp.Topics {
+		if err := kerr.ErrorForCode(t.ErrorCode); err != nil {
+			return fmt.Errorf("add partitions to topic %q: %w", t.Topic, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"gopkg.in/yaml.v3"
+)
+
+// scenario is a timed script of cluster changes, e.g.:
+//
+//	steps:
+//	  - at: 5s
+//	    action: add-broker
+//	  - after: 2s
+//	    action: move-leader
+//	    topic: foo
+//	    partition: 0
+//	    broker: 3
+//	  - action: pause-broker
+//	    broker: 1
+//	    duration: 10s
+type scenario struct {
+	Steps []scenarioStep `yaml:"steps"`
+}
+
+type scenarioStep struct {
+	// At is the time since the scenario started to run the step at. If
+	// unset, the step runs After the previous one.
+	At    *time.Duration `yaml:"at"`
+	After time.Duration  `yaml:"after"`
+
+	Action     string        `yaml:"action"`
+	Broker     *int32        `yaml:"broker"`
+	Port       int           `yaml:"port"`
+	Topic      string        `yaml:"topic"`
+	Partition  int32         `yaml:"partition"`
+	Partitions int32         `yaml:"partitions"`
+	Group      string        `yaml:"group"`
+	Offset     int64         `yaml:"offset"`
+	Duration   time.Duration `yaml:"duration"`
+}
+
+const (
+	actionAddBroker      = "add-broker"
+	actionRemoveBroker   = "remove-broker"
+	actionMoveLeader     = "move-leader"
+	actionShuffleLeaders = "shuffle-leaders"
+	actionCreateTopic    = "create-topic"
+	actionDeleteTopic    = "delete-topic"
+	actionPauseBroker    = "pause-broker"
+	actionCommitOffset   = "commit-offset"
+)
+
+func (s scenarioStep) validate() error {
+	switch s.Action {
+	case actionAddBroker, actionShuffleLeaders:
+	case actionRemoveBroker:
+		if s.Broker == nil {
+			return fmt.Errorf("%s requires broker", s.Action)
+		}
+	case actionMoveLeader:
+		if s.Topic == "" || s.Broker == nil {
+			return fmt.Errorf("%s requires topic, partition and broker", s.Action)
+		}
+	case actionCreateTopic, actionDeleteTopic:
+		if s.Topic == "" {
+			return fmt.Errorf("%s requires topic", s.Action)
+		}
+	case actionPauseBroker:
+		if s.Broker == nil || s.Duration <= 0 {
+			return fmt.Errorf("%s requires broker and duration", s.Action)
+		}
+	case actionCommitOffset:
+		if s.Group == "" || s.Topic == "" {
+			return fmt.Errorf("%s requires group, topic, partition and offset", s.Action)
+		}
+	default:
+		return fmt.Errorf("unknown action %q", s.Action)
+	}
+	return nil
+}
+
+func scenarioMain(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) error {
+	flagset := flag.NewFlagSet("kfake scenario", flag.ExitOnError)
+	flagset.SetOutput(stderr)
+	flagset.Usage = func() {
+		fmt.Fprintf(stderr, "usage: kfake scenario [options] <scenario.yaml>\n")
+		flagset.PrintDefaults()
+	}
+
+	var (
+		flagExit    bool
+		flagCluster = newClusterFlags()
+	)
+
+	flagCluster.register(flagset)
+	flagset.BoolVar(&flagExit, "exit", false, "exit after the last step instead of serving until interrupted")
+
+	if err := flagset.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if flagset.NArg() != 1 {
+		flagset.Usage()
+		return fmt.Errorf("expected exactly one scenario file")
+	}
+
+	b, err := os.ReadFile(flagset.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var sc scenario
+	if err := yaml.Unmarshal(b, &sc); err != nil {
+		return fmt.Errorf("%s: %w", flagset.Arg(0), err)
+	}
+
+	for i, step := range sc.Steps {
+		if err := step.validate(); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+
+	opts, err := flagCluster.options(stderr)
+	if err != nil {
+		return err
+	}
+
+	cluster, err := kfake.NewCluster(opts...)
+	if err != nil {
+		return err
+	}
+	defer cluster.Close()
+
+	client, err := kgo.NewClient(flagCluster.clientOpts(cluster.ListenAddrs())...)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	fmt.Fprintln(stdout, strings.Join(cluster.ListenAddrs(), ","))
+
+	r := &scenarioRunner{cluster: cluster, client: client, stdout: stdout, start: time.Now()}
+	if err := r.run(ctx, sc.Steps); err != nil {
+		return err
+	}
+
+	if flagExit {
+		return nil
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+type scenarioRunner struct {
+	cluster *kfake.Cluster
+	client  *kgo.Client
+	stdout  io.Writer
+	start   time.Time
+}
+
+func (r *scenarioRunner) run(ctx context.Context, steps []scenarioStep) error {
+	var last time.Duration
+	for i, step := range steps {
+		at := last + step.After
+		if step.At != nil {
+			at = *step.At
+		}
+		last = at
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(r.start.Add(at))):
+		}
+
+		detail, err := r.apply(ctx, step)
+		if err != nil {
+			r.log(step.Action, "failed: %v", err)
+			return fmt.Errorf("step %d (%s): %w", i+1, step.Action, err)
+		}
+		r.log(step.Action, "%s", detail)
+	}
+
+	return nil
+}
+
+func (r *scenarioRunner) log(action string, format string, args ...any) {
+	now := time.Now()
+	fmt.Fprintf(r.stdout, "%s +%s %s %s\n",
+		now.UTC().Format(time.RFC3339Nano),
+		now.Sub(r.start).Truncate(time.Millisecond),
+		action,
+		fmt.Sprintf(format, args...),
+	)
+}
+
+func (r *scenarioRunner) apply(ctx context.Context, step scenarioStep) (string, error) {
+	switch step.Action {
+	case actionAddBroker:
+		id := int32(-1)
+		if step.Broker != nil {
+			id = *step.Broker
+		}
+		node, port, err := r.cluster.AddNode(id, step.Port)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("broker=%d port=%d", node, port), nil
+
+	case actionRemoveBroker:
+		if err := r.cluster.RemoveNode(*step.Broker); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("broker=%d", *step.Broker), nil
+
+	case actionMoveLeader:
+		if err := r.cluster.MoveTopicPartition(step.Topic, step.Partition, *step.Broker); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("topic=%s partition=%d broker=%d", step.Topic, step.Partition, *step.Broker), nil
+
+	case actionShuffleLeaders:
+		r.cluster.ShufflePartitionLeaders()
+		return "", nil
+
+	case actionCreateTopic:
+		partitions := step.Partitions
+		if partitions == 0 {
+			partitions = -1
+		}
+
+		req := kmsg.NewPtrCreateTopicsRequest()
+		t := kmsg.NewCreateTopicsRequestTopic()
+		t.Topic = step.Topic
+		t.NumPartitions = partitions
+		t.ReplicationFactor = -1
+		req.Topics = append(req.Topics, t)
+
+		resp, err := req.RequestWith(ctx, r.client)
+		if err != nil {
+			return "", err
+		}
+		for _, t := range resp.Topics {
+			if err := kerr.ErrorForCode(t.ErrorCode); err != nil {
+				return "", err
+			}
+			// Brokers report the partitions they created since v5,
+			// which is the only way to know the default.
+			if t.NumPartitions > 0 {
+				partitions = t.NumPartitions
+			}
+		}
+		return fmt.Sprintf("topic=%s partitions=%d", step.Topic, partitions), nil
+
+	case actionDeleteTopic:
+		req := kmsg.NewPtrDeleteTopicsRequest()
+		req.TopicNames = []string{step.Topic}
+		t := kmsg.NewDeleteTopicsRequestTopic()
+		t.Topic = kmsg.StringPtr(step.Topic)
+		req.Topics = append(req.Topics, t)
+
+		resp, err := req.RequestWith(ctx, r.client)
+		if err != nil {
+			return "", err
+		}
+		for _, t := range resp.Topics {
+			if err := kerr.ErrorForCode(t.ErrorCode); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("topic=%s", step.Topic), nil
+
+	case actionPauseBroker:
+		r.pause(*step.Broker, step.Duration)
+		return fmt.Sprintf("broker=%d duration=%s", *step.Broker, step.Duration), nil
+
+	case actionCommitOffset:
+		req := kmsg.NewPtrOffsetCommitRequest()
+		req.Group = step.Group
+		req.Generation = -1
+		t := kmsg.NewOffsetCommitRequestTopic()
+		t.Topic = step.Topic
+		p := kmsg.NewOffsetCommitRequestTopicPartition()
+		p.Partition = step.Partition
+		p.Offset = step.Offset
+		t.Partitions = append(t.Partitions, p)
+		req.Topics = append(req.Topics, t)
+
+		resp, err := req.RequestWith(ctx, r.client)
+		if err != nil {
+			return "", err
+		}
+		for _, t := range resp.Topics {
+			for _, p := range t.Partitions {
+				if err := kerr.ErrorForCode(p.ErrorCode); err != nil {
+					return "", err
+				}
+			}
+		}
+		return fmt.Sprintf("group=%s topic=%s partition=%d offset=%d", step.Group, step.Topic, step.Partition, step.Offset), nil
+	}
+
+	return "", fmt.Errorf("unknown action %q", step.Action)
+}
+
+// pause holds every request sent to broker until d has passed, as if the
+// broker stopped responding without closing connections.
+func (r *scenarioRunner) pause(broker int32, d time.Duration) {
+	until := time.Now().Add(d)
+
+	r.cluster.Control(func(kmsg.Request) (kmsg.Response, error, bool) {
+		if !time.Now().Before(until) {
+			r.cluster.DropControl()
+			return nil, nil, false
+		}
+
+		r.cluster.KeepControl()
+		if r.cluster.CurrentNode() == broker {
+			r.cluster.SleepControl(func() {
+				time.Sleep(time.Until(until))
+			})
+		}
+		return nil, nil, false
+	})
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+const snapshotFile = "snapshot.json"
+
+// snapshot is the persisted state of a cluster in -data-dir.
+//
+// It is taken through the Kafka protocol like any other client would, so
+// restored records get fresh offsets starting from zero; partitions whose
+// log start was moved by deletes or retention, or with transaction
+// markers, are compacted to the records that were still readable.
+// Committed offsets are translated to the compacted offsets on restore.
+type snapshot struct {
+	Time          time.Time         `json:"time"`
+	BrokerConfigs map[string]string `json:"broker_configs,omitempty"`
+	Topics        []snapshotTopic   `json:"topics,omitempty"`
+	Groups        []snapshotGroup   `json:"groups,omitempty"`
+}
+
+type snapshotTopic struct {
+	Topic      string            `json:"topic"`
+	Partitions int32             `json:"partitions"`
+	Configs    map[string]string `json:"configs,omitempty"`
+	Records    []snapshotRecord  `json:"records,omitempty"`
+}
+
+type snapshotRecord struct {
+	Partition int32 `json:"partition"`
+	// Offset is the offset of the record when the snapshot was taken.
+	Offset int64 `json:"offset"`
+	recordedRecord
+}
+
+type snapshotGroup struct {
+	Group   string           `json:"group"`
+	Offsets []snapshotOffset `json:"offsets"`
+}
+
+type snapshotOffset struct {
+	Topic     string  `json:"topic"`
+	Partition int32   `json:"partition"`
+	Offset    int64   `json:"offset"`
+	Metadata  *string `json:"metadata,omitempty"`
+}
+
+// loadSnapshot reads the snapshot in dir, returning nil if there is none
+// yet.
+func loadSnapshot(dir string) (*snapshot, error) {
+	b, err := os.ReadFile(filepath.Join(dir, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return nil, fmt.Errorf("%s: %w", snapshotFile, err)
+	}
+
+	return &snap, nil
+}
+
+// saveSnapshot writes snap to dir, replacing the previous snapshot
+// atomically.
+func saveSnapshot(dir string, snap *snapshot) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, snapshotFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := json.NewEncoder(f).Encode(snap); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(dir, snapshotFile))
+}
+
+// snapshotter periodically and finally persists the cluster's state.
+type snapshotter struct {
+	dir        string
+	clientOpts []kgo.Opt
+	stderr     io.Writer
+}
+
+func (s *snapshotter) run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.save(ctx); err != nil {
+				fmt.Fprintf(s.stderr, "snapshot failed: %v\n", err)
+			}
+		}
+	}
+}
+
+func (s *snapshotter) save(ctx context.Context) error {
+	client, err := kgo.NewClient(s.clientOpts...)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	snap, err := takeSnapshot(ctx, client, s.clientOpts)
+	if err != nil {
+		return err
+	}
+
+	return saveSnapshot(s.dir, snap)
+}
+
+func takeSnapshot(ctx context.Context, client *kgo.Client, clientOpts []kgo.Opt) (*snapshot, error) {
+	snap := &snapshot{Time: time.Now().UTC()}
+
+	meta, err := kmsg.NewPtrMetadataRequest().RequestWith(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("metadata: %w", err)
+	}
+
+	describe := kmsg.NewPtrDescribeConfigsRequest()
+	broker := kmsg.NewDescribeConfigsRequestResource()
+	broker.ResourceType = kmsg.ConfigResourceTypeBroker
+	describe.Resources = append(describe.Resources, broker)
+
+	topics := make(map[string]*snapshotTopic)
+	for _, t := range meta.Topics {
+		if t.Topic == nil || t.IsInternal {
+			continue
+		}
+
+		topics[*t.Topic] = &snapshotTopic{
+			Topic:      *t.Topic,
+			Partitions: int32(len(t.Partitions)),
+		}
+
+		r := kmsg.NewDescribeConfigsRequestResource()
+		r.ResourceType = kmsg.ConfigResourceTypeTopic
+		r.ResourceName = *t.Topic
+		describe.Resources = append(describe.Resources, r)
+	}
+
+	configs, err := describe.RequestWith(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("describe configs: %w", err)
+	}
+
+	for _, r := range configs.Resources {
+		if err := kerr.ErrorForCode(r.ErrorCode); err != nil {
+			return nil, fmt.Errorf("describe configs %q: %w", r.ResourceName, err)
+		}
+
+		dynamic := make(map[string]string)
+		for _, c := range r.Configs {
+			switch c.Source {
+			case kmsg.ConfigSourceDynamicTopicConfig,
+				kmsg.ConfigSourceDynamicBrokerConfig,
+				kmsg.ConfigSourceDynamicDefaultBrokerConfig:
+				if c.Value != nil {
+					dynamic[c.Name] = *c.Value
+				}
+			}
+		}
+		if len(dynamic) == 0 {
+			continue
+		}
+
+		switch r.ResourceType {
+		case kmsg.ConfigResourceTypeBroker:
+			snap.BrokerConfigs = dynamic
+		case kmsg.ConfigResourceTypeTopic:
+			if t, ok := topics[r.ResourceName]; ok {
+				t.Configs = dynamic
+			}
+		}
+	}
+
+	if err := snapshotRecords(ctx, client, clientOpts, topics); err != nil {
+		return nil, err
+	}
+
+	for _, t := range topics {
+		snap.Topics = append(snap.Topics, *t)
+	}
+	sort.Slice(snap.Topics, func(i, j int) bool { return snap.Topics[i].Topic < snap.Topics[j].Topic })
+
+	groups, err := snapshotGroups(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	snap.Groups = groups
+
+	return snap, nil
+}
+
+// snapshotRecords reads every partition from its log start offset up to the
+// high watermark observed when the snapshot started.
+func snapshotRecords(ctx context.Context, client *kgo.Client, clientOpts []kgo.Opt, topics map[string]*snapshotTopic) error {
+	listOffsets := func(timestamp int64) (map[string]map[int32]int64, error) {
+		req := kmsg.NewPtrListOffsetsRequest()
+		req.ReplicaID = -1
+		for _, t := range topics {
+			rt := kmsg.NewListOffsetsRequestTopic()
+			rt.Topic = t.Topic
+			for p := int32(0); p < t.Partitions; p++ {
+				rp := kmsg.NewListOffsetsRequestTopicPartition()
+				rp.Partition = p
+				rp.Timestamp = timestamp
+				rt.Partitions = append(rt.Partitions, rp)
+			}
+			req.Topics = append(req.Topics, rt)
+		}
+
+		resp, err := req.RequestWith(ctx, client)
+		if err != nil {
+			return nil, fmt.Errorf("list offsets: %w", err)
+		}
+
+		offsets := make(map[string]map[int32]int64)
+		for _, t := range resp.Topics {
+			offsets[t.Topic] = make(map[int32]int64)
+			for _, p := range t.Partitions {
+				if err := kerr.ErrorForCode(p.ErrorCode); err != nil {
+					return nil, fmt.Errorf("list offsets %s/%d: %w", t.Topic, p.Partition, err)
+				}
+				offsets[t.Topic][p.Partition] = p.Offset
+			}
+		}
+		return offsets, nil
+	}
+
+	if len(topics) == 0 {
+		return nil
+	}
+
+	starts, err := listOffsets(-2)
+	if err != nil {
+		return err
+	}
+
+	ends, err := listOffsets(-1)
+	if err != nil {
+		return err
+	}
+
+	consume := make(map[string]map[int32]kgo.Offset)
+	remaining := 0
+	for topic, partitions := range ends {
+		for p, end := range partitions {
+			start := starts[topic][p]
+			if end <= start {
+				continue
+			}
+			if consume[topic] == nil {
+				consume[topic] = make(map[int32]kgo.Offset)
+			}
+			consume[topic][p] = kgo.NewOffset().At(start)
+			remaining++
+		}
+	}
+
+	if remaining == 0 {
+		return nil
+	}
+
+	consumer, err := kgo.NewClient(append(clientOpts, kgo.ConsumePartitions(consume))...)
+	if err != nil {
+		return err
+	}
+	defer consumer.Close()
+
+	done := make(map[string]map[int32]bool)
+	for remaining > 0 {
+		pollCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		fetches := consumer.PollFetches(pollCtx)
+		cancel()
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var fetchErr error
+		fetches.EachError(func(topic string, partition int32, err error) {
+			if fetchErr == nil && !errors.Is(err, context.DeadlineExceeded) {
+				fetchErr = fmt.Errorf("fetch %s/%d: %w", topic, partition, err)
+			}
+		})
+		if fetchErr != nil {
+			return fetchErr
+		}
+
+		var polled bool
+		fetches.EachRecord(func(r *kgo.Record) {
+			polled = true
+
+			if done[r.Topic][r.Partition] {
+				return
+			}
+
+			rec := snapshotRecord{
+				Partition: r.Partition,
+				Offset:    r.Offset,
+				recordedRecord: recordedRecord{
+					Key:       r.Key,
+					Value:     r.Value,
+					Timestamp: r.Timestamp.UnixMilli(),
+				},
+			}
+			for _, h := range r.Headers {
+				rec.Headers = append(rec.Headers, recordedHeader{Key: h.Key, Value: h.Value})
+			}
+			topics[r.Topic].Records = append(topics[r.Topic].Records, rec)
+
+			if r.Offset+1 >= ends[r.Topic][r.Partition] {
+				if done[r.Topic] == nil {
+					done[r.Topic] = make(map[int32]bool)
+				}
+				done[r.Topic][r.Partition] = true
+				remaining--
+			}
+		})
+
+		// Control records (transaction markers) are never returned, so a
+		// partition ending in one is never marked done; stop once polls
+		// run dry instead of waiting forever.
+		if !polled {
+			break
+		}
+	}
+
+	return nil
+}
+
+func snapshotGroups(ctx context.Context, client *kgo.Client) ([]snapshotGroup, error) {
+	list, err := kmsg.NewPtrListGroupsRequest().RequestWith(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("list groups: %w", err)
+	}
+
+	if len(list.Groups) == 0 {
+		return nil, nil
+	}
+
+	req := kmsg.NewPtrOffsetFetchRequest()
+	for _, g := range list.Groups {
+		rg := kmsg.NewOffsetFetchRequestGroup()
+		rg.Group = g.Group
+		req.Groups = append(req.Groups, rg)
+	}
+
+	resp, err := req.RequestWith(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("offset fetch: %w", err)
+	}
+
+	var groups []snapshotGroup
+	for _, g := range resp.Groups {
+		if err := kerr.ErrorForCode(g.ErrorCode); err != nil {
+			return nil, fmt.Errorf("offset fetch %q: %w", g.Group, err)
+		}
+
+		sg := snapshotGroup{Group: g.Group}
+		for _, t := range g.Topics {
+			for _, p := range t.Partitions {
+				if p.Offset < 0 || kerr.ErrorForCode(p.ErrorCode) != nil {
+					continue
+				}
+				sg.Offsets = append(sg.Offsets, snapshotOffset{
+					Topic:     t.Topic,
+					Partition: p.Partition,
+					Offset:    p.Offset,
+					Metadata:  p.Metadata,
+				})
+			}
+		}
+		if len(sg.Offsets) > 0 {
+			groups = append(groups, sg)
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Group < groups[j].Group })
+
+	return groups, nil
+}
+
+// restoreSnapshot recreates the topics, records and committed offsets of
+// snap. Broker configs are restored through kfake.BrokerConfigs when the
+// cluster is created.
+func restoreSnapshot(ctx context.Context, clientOpts []kgo.Opt, snap *snapshot) error {
+	client, err := kgo.NewClient(append(clientOpts, kgo.RecordPartitioner(kgo.ManualPartitioner()))...)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if len(snap.Topics) > 0 {
+		req := kmsg.NewPtrCreateTopicsRequest()
+		for _, t := range snap.Topics {
+			rt := kmsg.NewCreateTopicsRequestTopic()
+			rt.Topic = t.Topic
+			rt.NumPartitions = t.Partitions
+			rt.ReplicationFactor = -1
+			for k, v := range t.Configs {
+				c := kmsg.NewCreateTopicsRequestTopicConfig()
+				c.Name = k
+				c.Value = kmsg.StringPtr(v)
+				rt.Configs = append(rt.Configs, c)
+			}
+			req.Topics = append(req.Topics, rt)
+		}
+
+		resp, err := req.RequestWith(ctx, client)
+		if err != nil {
+			return fmt.Errorf("create topics: %w", err)
+		}
+		for _, t := range resp.Topics {
+			if err := kerr.ErrorForCode(t.ErrorCode); err != nil {
+				return fmt.Errorf("create topic %q: %w", t.Topic, err)
+			}
+		}
+	}
+
+	var records []*kgo.Record
+	for _, t := range snap.Topics {
+		for _, r := range t.Records {
+			rec := &kgo.Record{
+				Topic:     t.Topic,
+				Partition: r.Partition,
+				Key:       r.Key,
+				Value:     r.Value,
+				Timestamp: time.UnixMilli(r.Timestamp),
+			}
+			for _, h := range r.Headers {
+				rec.Headers = append(rec.Headers, kgo.RecordHeader{Key: h.Key, Value: h.Value})
+			}
+			records = append(records, rec)
+		}
+	}
+
+	if len(records) > 0 {
+		if err := client.ProduceSync(ctx, records...).FirstErr(); err != nil {
+			return fmt.Errorf("produce: %w", err)
+		}
+	}
+
+	restored := snap.restoredOffsets()
+	for _, g := range snap.Groups {
+		req := kmsg.NewPtrOffsetCommitRequest()
+		req.Group = g.Group
+		req.Generation = -1
+		for _, o := range g.Offsets {
+			rt := kmsg.NewOffsetCommitRequestTopic()
+			rt.Topic = o.Topic
+			rp := kmsg.NewOffsetCommitRequestTopicPartition()
+			rp.Partition = o.Partition
+			rp.Offset = restored.translate(o.Topic, o.Partition, o.Offset)
+			rp.Metadata = o.Metadata
+			rt.Partitions = append(rt.Partitions, rp)
+			req.Topics = append(req.Topics, rt)
+		}
+
+		resp, err := req.RequestWith(ctx, client)
+		if err != nil {
+			return fmt.Errorf("offset commit %q: %w", g.Group, err)
+		}
+		for _, t := range resp.Topics {
+			for _, p := range t.Partitions {
+				if err := kerr.ErrorForCode(p.ErrorCode); err != nil {
+					return fmt.Errorf("offset commit %q %s/%d: %w", g.Group, t.Topic, p.Partition, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// restoredOffsets are the snapshotted offsets of the records of every
+// partition, in the order they are restored.
+type restoredOffsets map[string]map[int32][]int64
+
+func (snap *snapshot) restoredOffsets() restoredOffsets {
+	offsets := make(restoredOffsets)
+	for _, t := range snap.Topics {
+		partitions := make(map[int32][]int64)
+		for _, r := range t.Records {
+			partitions[r.Partition] = append(partitions[r.Partition], r.Offset)
+		}
+		offsets[t.Topic] = partitions
+	}
+	return offsets
+}
+
+// translate returns the offset a committed offset has once the partition
+// is restored: the number of restored records before it. Commits pointing
+// into a gap, such as below the log start or at a transaction marker,
+// move to the next restored record.
+func (o restoredOffsets) translate(topic string, partition int32, offset int64) int64 {
+	offsets := o[topic][partition]
+	return int64(sort.Search(len(offsets), func(i int) bool { return offsets[i] >= offset }))
+}
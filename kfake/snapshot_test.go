@@ -0,0 +1,130 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	got, err := loadSnapshot(dir)
+	if err != nil {
+		t.Fatalf("load empty dir: %v", err)
+	}
+	if got != nil {
+		t.Fatalf("load empty dir: got %+v, want nil", got)
+	}
+
+	want := &snapshot{
+		Time:          time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC),
+		BrokerConfigs: map[string]string{"log.retention.ms": "60000"},
+		Topics: []snapshotTopic{
+			{
+				Topic:      "orders",
+				Partitions: 2,
+				Configs:    map[string]string{"cleanup.policy": "compact"},
+				Records: []snapshotRecord{
+					{
+						Partition: 0,
+						Offset:    4,
+						recordedRecord: recordedRecord{
+							Key:       []byte("k"),
+							Value:     []byte("v"),
+							Headers:   []recordedHeader{{Key: "h", Value: []byte("x")}},
+							Timestamp: 1740830400000,
+						},
+					},
+					{
+						Partition: 1,
+						Offset:    0,
+						recordedRecord: recordedRecord{
+							Value:     []byte("w"),
+							Timestamp: 1740830400001,
+						},
+					},
+				},
+			},
+			{Topic: "empty", Partitions: 1},
+		},
+		Groups: []snapshotGroup{
+			{
+				Group: "billing",
+				Offsets: []snapshotOffset{
+					{Topic: "orders", Partition: 0, Offset: 5, Metadata: ptr("meta")},
+				},
+			},
+		},
+	}
+
+	// Saving twice replaces the previous snapshot.
+	if err := saveSnapshot(dir, &snapshot{Time: want.Time.Add(-time.Hour)}); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if err := saveSnapshot(dir, want); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	got, err = loadSnapshot(dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty(), cmp.AllowUnexported(snapshotRecord{})); diff != "" {
+		t.Errorf("round trip mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRestoredOffsetsTranslate(t *testing.T) {
+	// orders/0 had its log start moved to 10 and a transaction marker at
+	// 13; orders/1 was emptied by retention at 7.
+	snap := &snapshot{
+		Topics: []snapshotTopic{
+			{
+				Topic:      "orders",
+				Partitions: 2,
+				Records: []snapshotRecord{
+					{Partition: 0, Offset: 10},
+					{Partition: 0, Offset: 11},
+					{Partition: 0, Offset: 12},
+					{Partition: 0, Offset: 14},
+					{Partition: 0, Offset: 15},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		topic     string
+		partition int32
+		committed int64
+		want      int64
+	}{
+		{"committed mid-partition", "orders", 0, 12, 2},
+		{"committed at log start", "orders", 0, 10, 0},
+		{"committed below log start", "orders", 0, 3, 0},
+		{"committed at transaction marker", "orders", 0, 13, 3},
+		{"committed after marker", "orders", 0, 14, 3},
+		{"committed at high watermark", "orders", 0, 16, 5},
+		{"committed on emptied partition", "orders", 1, 7, 0},
+		{"unknown topic", "payments", 0, 42, 0},
+	}
+
+	restored := snap.restoredOffsets()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := restored.translate(tt.topic, tt.partition, tt.committed)
+			if got != tt.want {
+				t.Errorf("translate(%s, %d, %d) = %d, want %d", tt.topic, tt.partition, tt.committed, got, tt.want)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
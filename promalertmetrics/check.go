@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// checkMain reports every rule that reads a metric that is neither in the
+// catalog nor recorded by one of the rules.
+func checkMain(
+	stdout *os.File,
+	stderr *os.File,
+	args []string,
+) error {
+	fs := flag.NewFlagSet(args[0], flag.ExitOnError)
+	catalogPath := fs.String("catalog", "", "File of known metric names, one per line, or a /api/v1/label/__name__/values response")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s -catalog <file> <rules-files>\n", args[0])
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if *catalogPath == "" || len(fs.Args()) == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected a catalog and at least one rules file")
+	}
+
+	catalog, err := loadCatalog(*catalogPath)
+	if err != nil {
+		return fmt.Errorf("failed to load catalog: %w", err)
+	}
+
+	rules, err := loadRules(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rules {
+		if r.rule.Record != "" {
+			catalog[r.rule.Record] = true
+		}
+	}
+
+	var failed int
+	for _, r := range rules {
+		var missing []string
+		for _, vs := range selectors(r.expr) {
+			name := metricName(vs)
+			if name == "" || catalog[name] || slices.Contains(missing, name) {
+				continue
+			}
+			missing = append(missing, name)
+		}
+
+		if len(missing) == 0 {
+			continue
+		}
+		failed++
+
+		for _, name := range missing {
+			fmt.Fprintf(stdout, "%s: %s/%s: unknown metric %s\n", r.file, r.group, r.name(), name)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d rules reference unknown metrics", failed)
+	}
+
+	return nil
+}
+
+// loadCatalog reads the set of known metric names from path. The file is
+// either a Prometheus label values API response or a list of names, one
+// per line, with blank lines and lines starting with # ignored.
+func loadCatalog(path string) (map[string]bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := map[string]bool{}
+
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		var resp struct {
+			Status string   `json:"status"`
+			Data   []string `json:"data"`
+			Error  string   `json:"error"`
+		}
+		if err := json.Unmarshal(b, &resp); err != nil {
+			return nil, err
+		}
+		if resp.Status != "success" {
+			return nil, fmt.Errorf("response status %q: %s", resp.Status, resp.Error)
+		}
+
+		for _, name := range resp.Data {
+			catalog[name] = true
+		}
+
+		return catalog, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		catalog[line] = true
+	}
+
+	return catalog, scanner.Err()
+}
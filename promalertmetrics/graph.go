@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ruleGraph is the dependency graph of rules on the series recorded by
+// other rules.
+type ruleGraph struct {
+	rules []graphRule
+	// recorders maps a recorded series to the rules recording it.
+	recorders map[string][]int
+}
+
+type graphRule struct {
+	loadedRule
+	// reads are the metric names the rule reads.
+	reads []string
+}
+
+func newRuleGraph(rules []loadedRule) *ruleGraph {
+	g := &ruleGraph{recorders: map[string][]int{}}
+
+	for i, r := range rules {
+		gr := graphRule{loadedRule: r}
+		for _, vs := range selectors(r.expr) {
+			if name := metricName(vs); name != "" && !slices.Contains(gr.reads, name) {
+				gr.reads = append(gr.reads, name)
+			}
+		}
+		g.rules = append(g.rules, gr)
+
+		if r.rule.Record != "" {
+			g.recorders[r.rule.Record] = append(g.recorders[r.rule.Record], i)
+		}
+	}
+
+	return g
+}
+
+// dependencies returns the indexes of the rules recording the series rule
+// i reads.
+func (g *ruleGraph) dependencies(i int) []int {
+	var deps []int
+	for _, name := range g.rules[i].reads {
+		deps = append(deps, g.recorders[name]...)
+	}
+	return deps
+}
+
+// cycles returns every cycle of recording rules, each as the names of the
+// rules in it with the first one repeated at the end.
+func (g *ruleGraph) cycles() [][]string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	var (
+		state  = make([]int, len(g.rules))
+		stack  []int
+		cycles [][]string
+		visit  func(int)
+	)
+
+	visit = func(i int) {
+		state[i] = visiting
+		stack = append(stack, i)
+
+		for _, d := range g.dependencies(i) {
+			switch state[d] {
+			case unvisited:
+				visit(d)
+			case visiting:
+				start := slices.Index(stack, d)
+				var cycle []string
+				for _, j := range stack[start:] {
+					cycle = append(cycle, g.rules[j].name())
+				}
+				cycles = append(cycles, append(cycle, g.rules[d].name()))
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[i] = visited
+	}
+
+	for i := range g.rules {
+		if state[i] == unvisited {
+			visit(i)
+		}
+	}
+
+	return cycles
+}
+
+// unused returns the series recorded by rules that no rule reads.
+func (g *ruleGraph) unused() []string {
+	read := map[string]bool{}
+	for _, r := range g.rules {
+		for _, name := range r.reads {
+			read[name] = true
+		}
+	}
+
+	var unused []string
+	for name := range g.recorders {
+		if !read[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+
+	return unused
+}
+
+// baseMetrics returns the metrics not recorded by any rule that rule i
+// reads, directly or through the recording rules it depends on.
+func (g *ruleGraph) baseMetrics(i int) []string {
+	var (
+		seen  = map[int]bool{}
+		base  []string
+		visit func(int)
+	)
+
+	visit = func(i int) {
+		if seen[i] {
+			return
+		}
+		seen[i] = true
+
+		for _, name := range g.rules[i].reads {
+			deps := g.recorders[name]
+			if len(deps) == 0 && !slices.Contains(base, name) {
+				base = append(base, name)
+			}
+			for _, d := range deps {
+				visit(d)
+			}
+		}
+	}
+	visit(i)
+
+	sort.Strings(base)
+
+	return base
+}
+
+// nodeID returns the node of rule i in the DOT output. Rules recording the
+// same series share a node.
+func (g *ruleGraph) nodeID(i int) string {
+	r := g.rules[i]
+	if r.rule.Alert != "" {
+		return "alert:" + r.rule.Alert
+	}
+	return r.rule.Record
+}
+
+func (g *ruleGraph) writeDOT(w io.Writer) {
+	var (
+		nodes = map[string]bool{}
+		edges = map[string]bool{}
+		lines []string
+	)
+
+	node := func(id, attrs string) {
+		if !nodes[id] {
+			nodes[id] = true
+			lines = append(lines, fmt.Sprintf("  %q [%s];", id, attrs))
+		}
+	}
+	edge := func(from, to string) {
+		if e := fmt.Sprintf("  %q -> %q;", from, to); !edges[e] {
+			edges[e] = true
+			lines = append(lines, e)
+		}
+	}
+
+	unused := g.unused()
+	for i, r := range g.rules {
+		id := g.nodeID(i)
+		switch {
+		case r.rule.Alert != "":
+			node(id, fmt.Sprintf("label=%q, shape=octagon", r.rule.Alert))
+		case slices.Contains(unused, id):
+			node(id, "shape=box, style=dashed")
+		default:
+			node(id, "shape=box")
+		}
+
+		for _, name := range r.reads {
+			deps := g.recorders[name]
+			if len(deps) == 0 {
+				node(name, "shape=ellipse")
+				edge(id, name)
+			}
+			for _, d := range deps {
+				edge(id, g.nodeID(d))
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "digraph rules {\n%s\n}\n", strings.Join(lines, "\n"))
+}
+
+type graphJSON struct {
+	Rules  []graphJSONRule     `json:"rules"`
+	Cycles [][]string          `json:"cycles"`
+	Unused []string            `json:"unused"`
+	Alerts map[string][]string `json:"alerts"`
+}
+
+type graphJSONRule struct {
+	File      string   `json:"file"`
+	Group     string   `json:"group"`
+	Kind      string   `json:"kind"`
+	Name      string   `json:"name"`
+	Reads     []string `json:"reads"`
+	DependsOn []string `json:"depends_on"`
+}
+
+func (g *ruleGraph) writeJSON(w io.Writer) error {
+	out := graphJSON{
+		Rules:  []graphJSONRule{},
+		Cycles: g.cycles(),
+		Unused: g.unused(),
+		Alerts: map[string][]string{},
+	}
+	if out.Cycles == nil {
+		out.Cycles = [][]string{}
+	}
+	if out.Unused == nil {
+		out.Unused = []string{}
+	}
+
+	for i, r := range g.rules {
+		jr := graphJSONRule{
+			File:      r.file,
+			Group:     r.group,
+			Kind:      r.kind(),
+			Name:      r.name(),
+			Reads:     append([]string{}, r.reads...),
+			DependsOn: []string{},
+		}
+		for _, name := range r.reads {
+			if len(g.recorders[name]) > 0 {
+				jr.DependsOn = append(jr.DependsOn, name)
+			}
+		}
+		out.Rules = append(out.Rules, jr)
+
+		if r.rule.Alert != "" {
+			out.Alerts[r.rule.Alert] = append(out.Alerts[r.rule.Alert], g.baseMetrics(i)...)
+		}
+	}
+
+	for name, base := range out.Alerts {
+		sort.Strings(base)
+		out.Alerts[name] = append([]string{}, slices.Compact(base)...)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(out)
+}
+
+// graphMain prints the dependency graph of the rules as DOT or JSON, and
+// fails if recording rules depend on each other in a cycle.
+func graphMain(
+	stdout *os.File,
+	stderr *os.File,
+	args []string,
+) error {
+	fs := flag.NewFlagSet(args[0], flag.ExitOnError)
+	format := fs.String("format", "dot", "Output format: dot or json")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s [options] <rules-files>\n", args[0])
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if *format != "dot" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	if len(fs.Args()) == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected at least one rules file")
+	}
+
+	rules, err := loadRules(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	g := newRuleGraph(rules)
+
+	if *format == "json" {
+		if err := g.writeJSON(stdout); err != nil {
+			return err
+		}
+	} else {
+		g.writeDOT(stdout)
+
+		for _, name := range g.unused() {
+			fmt.Fprintf(stderr, "unused recording rule: %s\n", name)
+		}
+		for i, r := range g.rules {
+			if r.rule.Alert != "" {
+				fmt.Fprintf(stderr, "alert %s reads: %s\n", r.rule.Alert, strings.Join(g.baseMetrics(i), ", "))
+			}
+		}
+	}
+
+	cycles := g.cycles()
+	for _, c := range cycles {
+		fmt.Fprintf(stderr, "cycle: %s\n", strings.Join(c, " -> "))
+	}
+	if len(cycles) > 0 {
+		return fmt.Errorf("found %d dependency cycles", len(cycles))
+	}
+
+	return nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+// inventoryRule is a rule and the series it reads.
+type inventoryRule struct {
+	File        string            `json:"file"`
+	Group       string            `json:"group"`
+	Kind        string            `json:"kind"`
+	Name        string            `json:"name"`
+	Expr        string            `json:"expr"`
+	For         string            `json:"for,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Series      []inventorySeries `json:"series"`
+}
+
+// inventorySeries is a selector of a rule. Name is empty for selectors
+// that select series by their labels only.
+type inventorySeries struct {
+	Name     string             `json:"name"`
+	Matchers []inventoryMatcher `json:"matchers,omitempty"`
+}
+
+type inventoryMatcher struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func (s inventorySeries) String() string {
+	if len(s.Matchers) == 0 {
+		return s.Name
+	}
+
+	ms := make([]string, 0, len(s.Matchers))
+	for _, m := range s.Matchers {
+		ms = append(ms, fmt.Sprintf("%s%s%q", m.Name, m.Type, m.Value))
+	}
+
+	return s.Name + "{" + strings.Join(ms, ",") + "}"
+}
+
+// inventory returns the inventory of rules. Every selector without a
+// metric name is reported to warn.
+func inventory(rules []loadedRule, warn io.Writer) []inventoryRule {
+	inv := make([]inventoryRule, 0, len(rules))
+
+	for _, r := range rules {
+		ir := inventoryRule{
+			File:        r.file,
+			Group:       r.group,
+			Kind:        r.kind(),
+			Name:        r.name(),
+			Expr:        r.expr.String(),
+			Labels:      r.rule.Labels,
+			Annotations: r.rule.Annotations,
+			Series:      []inventorySeries{},
+		}
+		if r.rule.For != 0 {
+			ir.For = r.rule.For.String()
+		}
+
+		for _, vs := range selectors(r.expr) {
+			s := inventorySeries{Name: metricName(vs)}
+			if s.Name == "" {
+				fmt.Fprintf(warn, "%s: %s/%s: selector %s has no metric name\n", r.file, r.group, r.name(), vs)
+			}
+
+			for _, m := range vs.LabelMatchers {
+				if m.Name == labels.MetricName && m.Type == labels.MatchEqual {
+					continue
+				}
+				s.Matchers = append(s.Matchers, inventoryMatcher{
+					Name:  m.Name,
+					Type:  m.Type.String(),
+					Value: m.Value,
+				})
+			}
+
+			ir.Series = append(ir.Series, s)
+		}
+
+		inv = append(inv, ir)
+	}
+
+	return inv
+}
+
+func writeInventoryJSON(w io.Writer, inv []inventoryRule) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(inv)
+}
+
+// writeInventoryCSV writes a row for every series of every rule, or a
+// single row without series for rules that read none.
+func writeInventoryCSV(w io.Writer, inv []inventoryRule) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write([]string{"file", "group", "kind", "name", "for", "series", "matchers", "labels", "annotations"}); err != nil {
+		return err
+	}
+
+	for _, r := range inv {
+		row := []string{r.File, r.Group, r.Kind, r.Name, r.For, "", "", mapString(r.Labels), mapString(r.Annotations)}
+
+		if len(r.Series) == 0 {
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, s := range r.Series {
+			row[5] = s.Name
+			row[6] = strings.TrimPrefix(s.String(), s.Name)
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
+
+// writeInventoryText writes the metric names the rules read, once each,
+// or once per file under its name if showFileNames is set.
+func writeInventoryText(w io.Writer, inv []inventoryRule, showFileNames bool) {
+	var (
+		seen = map[string]bool{}
+		file string
+	)
+
+	for _, r := range inv {
+		for _, s := range r.Series {
+			key := s.Name
+			if showFileNames {
+				key = r.File + "\x00" + s.Name
+			}
+			if s.Name == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			if !showFileNames {
+				fmt.Fprintf(w, "%v\n", s.Name)
+				continue
+			}
+
+			if r.File != file {
+				file = r.File
+				fmt.Fprintf(w, "%v:\n", file)
+			}
+			fmt.Fprintf(w, "  %v\n", s.Name)
+		}
+	}
+}
+
+// mapString returns m in the label set notation, e.g. {a="b", c="d"}, or
+// "" if m is empty.
+func mapString(m map[string]string) string {
+	if len(m) == 0 {
+		return ""
+	}
+	return labels.FromMap(m).String()
+}
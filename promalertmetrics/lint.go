@@ -0,0 +1,415 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/promql/parser/posrange"
+)
+
+// lintRule is a check of the lint subcommand.
+type lintRule struct {
+	id          string
+	description string
+}
+
+var (
+	lintRateGauge         = lintRule{"rate-on-gauge", "rate, irate or increase over a metric not named like a counter"}
+	lintShortRange        = lintRule{"rate-range-too-short", "rate range shorter than twice the scrape interval"}
+	lintMissingFor        = lintRule{"alert-missing-for", "alert without a for clause"}
+	lintMissingAnnotation = lintRule{"alert-missing-annotation", "alert without a summary or runbook_url annotation"}
+	lintDroppedLabel      = lintRule{"annotation-label-dropped", "annotation template uses a label the expression aggregates or matches away"}
+	lintRegexEquality     = lintRule{"regex-could-be-equality", "regex matcher without regex syntax"}
+
+	lintRules = []lintRule{
+		lintRateGauge,
+		lintShortRange,
+		lintMissingFor,
+		lintMissingAnnotation,
+		lintDroppedLabel,
+		lintRegexEquality,
+	}
+)
+
+// requiredAnnotations are the annotations every alert should have.
+var requiredAnnotations = []string{"summary", "runbook_url"}
+
+// counterSuffixes are the suffixes of counter metric names.
+var counterSuffixes = []string{"_total", "_count", "_sum", "_bucket"}
+
+type finding struct {
+	rule    lintRule
+	file    string
+	line    int
+	group   string
+	name    string
+	message string
+}
+
+func (f finding) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s/%s: %s", f.file, f.line, f.rule.id, f.group, f.name, f.message)
+}
+
+// lint returns the findings for r, with selectors reading at most every
+// scrapeInterval.
+func lint(r loadedRule, scrapeInterval time.Duration) []finding {
+	var findings []finding
+	report := func(rule lintRule, line int, format string, args ...any) {
+		if line == 0 {
+			line = r.pos.line
+		}
+		findings = append(findings, finding{
+			rule:    rule,
+			file:    r.file,
+			line:    line,
+			group:   r.group,
+			name:    r.name(),
+			message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	// exprLine returns the line of the node at pos of the expression.
+	exprLine := func(pos posrange.PositionRange) int {
+		if r.pos.exprLine == 0 {
+			return 0
+		}
+		start := min(int(pos.Start), len(r.rule.Expr))
+		return r.pos.exprLine + strings.Count(r.rule.Expr[:start], "\n")
+	}
+
+	parser.Inspect(r.expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.Call:
+			switch n.Func.Name {
+			case "rate", "irate", "increase":
+			default:
+				return nil
+			}
+			if len(n.Args) == 0 {
+				return nil
+			}
+			ms, ok := n.Args[0].(*parser.MatrixSelector)
+			if !ok {
+				return nil
+			}
+
+			name := metricName(ms.VectorSelector.(*parser.VectorSelector))
+			if name != "" && !slices.ContainsFunc(counterSuffixes, func(s string) bool { return strings.HasSuffix(name, s) }) {
+				report(lintRateGauge, exprLine(n.PosRange), "%s over %s, which is not named like a counter", n.Func.Name, name)
+			}
+
+			if ms.Range < 2*scrapeInterval {
+				report(lintShortRange, exprLine(ms.PositionRange()), "%s range %s is shorter than twice the scrape interval %s",
+					n.Func.Name, model.Duration(ms.Range), model.Duration(scrapeInterval))
+			}
+
+		case *parser.VectorSelector:
+			for _, m := range n.LabelMatchers {
+				if m.Type != labels.MatchRegexp && m.Type != labels.MatchNotRegexp {
+					continue
+				}
+				if regexp.QuoteMeta(m.Value) != m.Value {
+					continue
+				}
+
+				op := labels.MatchEqual
+				if m.Type == labels.MatchNotRegexp {
+					op = labels.MatchNotEqual
+				}
+				report(lintRegexEquality, exprLine(n.PosRange), "%s can be %s%s%q", m, m.Name, op, m.Value)
+			}
+		}
+
+		return nil
+	})
+
+	if r.rule.Alert == "" {
+		return findings
+	}
+
+	if r.rule.For == 0 {
+		report(lintMissingFor, 0, "alert has no for clause and fires on the first evaluation")
+	}
+
+	for _, a := range requiredAnnotations {
+		if _, ok := r.rule.Annotations[a]; !ok {
+			report(lintMissingAnnotation, 0, "alert has no %s annotation", a)
+		}
+	}
+
+	if dropsLabels(r.expr) {
+		annotations := make([]string, 0, len(r.rule.Annotations))
+		for a := range r.rule.Annotations {
+			annotations = append(annotations, a)
+		}
+		sort.Strings(annotations)
+
+		for _, a := range annotations {
+			for _, l := range templateLabels(r.rule.Annotations[a]) {
+				if !keepsLabel(r.expr, l) {
+					report(lintDroppedLabel, r.pos.annotationLines[a], "annotation %s uses label %s, which the expression drops", a, l)
+				}
+			}
+		}
+	}
+
+	return findings
+}
+
+// dropsLabels reports whether expr has an aggregation or a one-to-one
+// vector matching with on() or ignoring(), which can drop labels of the
+// selected series.
+func dropsLabels(expr parser.Expr) bool {
+	var found bool
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		switch n := node.(type) {
+		case *parser.AggregateExpr:
+			found = true
+		case *parser.BinaryExpr:
+			vm := n.VectorMatching
+			if vm != nil && vm.Card == parser.CardOneToOne && (vm.On || len(vm.MatchingLabels) > 0) {
+				found = true
+			}
+		}
+		return nil
+	})
+	return found
+}
+
+// templateLabelRe matches label references of alert templates, i.e.
+// $labels.name and .Labels.name.
+var templateLabelRe = regexp.MustCompile(`(?:\$labels|\.Labels)\.([a-zA-Z_][a-zA-Z0-9_]*)`)
+
+// templateLabels returns the labels the template text references.
+func templateLabels(text string) []string {
+	var names []string
+	for _, m := range templateLabelRe.FindAllStringSubmatch(text, -1) {
+		if !slices.Contains(names, m[1]) {
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// keepsLabel reports whether the series expr returns can have label l.
+// Selectors are assumed to have every label.
+func keepsLabel(expr parser.Expr, l string) bool {
+	switch e := expr.(type) {
+	case *parser.AggregateExpr:
+		switch e.Op {
+		case parser.TOPK, parser.BOTTOMK, parser.LIMITK, parser.LIMIT_RATIO:
+			return keepsLabel(e.Expr, l)
+		case parser.COUNT_VALUES:
+			if s, ok := e.Param.(*parser.StringLiteral); ok && s.Val == l {
+				return true
+			}
+		}
+		if e.Without {
+			return !slices.Contains(e.Grouping, l) && keepsLabel(e.Expr, l)
+		}
+		return slices.Contains(e.Grouping, l) && keepsLabel(e.Expr, l)
+
+	case *parser.BinaryExpr:
+		lhs, rhs := e.LHS.Type() == parser.ValueTypeVector, e.RHS.Type() == parser.ValueTypeVector
+		switch {
+		case !lhs && !rhs:
+			return false
+		case !rhs:
+			return keepsLabel(e.LHS, l)
+		case !lhs:
+			return keepsLabel(e.RHS, l)
+		}
+
+		vm := e.VectorMatching
+		if vm == nil {
+			return keepsLabel(e.LHS, l)
+		}
+		switch {
+		case e.Op == parser.LOR:
+			return keepsLabel(e.LHS, l) || keepsLabel(e.RHS, l)
+		case e.Op == parser.LAND || e.Op == parser.LUNLESS:
+			return keepsLabel(e.LHS, l)
+		case vm.Card == parser.CardManyToOne:
+			return keepsLabel(e.LHS, l) || (slices.Contains(vm.Include, l) && keepsLabel(e.RHS, l))
+		case vm.Card == parser.CardOneToMany:
+			return keepsLabel(e.RHS, l) || (slices.Contains(vm.Include, l) && keepsLabel(e.LHS, l))
+		case vm.On:
+			return slices.Contains(vm.MatchingLabels, l) && keepsLabel(e.LHS, l)
+		default:
+			return !slices.Contains(vm.MatchingLabels, l) && keepsLabel(e.LHS, l)
+		}
+
+	case *parser.Call:
+		switch e.Func.Name {
+		case "label_replace", "label_join":
+			if len(e.Args) > 1 {
+				if s, ok := e.Args[1].(*parser.StringLiteral); ok && s.Val == l {
+					return true
+				}
+			}
+		case "vector", "time", "scalar":
+			return false
+		}
+		for _, a := range e.Args {
+			if a.Type() == parser.ValueTypeVector || a.Type() == parser.ValueTypeMatrix {
+				return keepsLabel(a, l)
+			}
+		}
+		return false
+
+	case *parser.ParenExpr:
+		return keepsLabel(e.Expr, l)
+	case *parser.UnaryExpr:
+		return keepsLabel(e.Expr, l)
+	case *parser.SubqueryExpr:
+		return keepsLabel(e.Expr, l)
+	case *parser.StepInvariantExpr:
+		return keepsLabel(e.Expr, l)
+	case *parser.NumberLiteral, *parser.StringLiteral:
+		return false
+	}
+
+	return true
+}
+
+// lintMain reports common mistakes in the rules and fails if any are
+// found.
+func lintMain(
+	stdout *os.File,
+	stderr *os.File,
+	args []string,
+) error {
+	fs := flag.NewFlagSet(args[0], flag.ExitOnError)
+	format := fs.String("format", "text", "Output format: text or sarif")
+	scrapeInterval := fs.Duration("scrape-interval", time.Minute, "Scrape interval of the metrics the rules read")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s [options] <rules-files>\n", args[0])
+		fs.PrintDefaults()
+		fmt.Fprintf(stderr, "\nChecks:\n")
+		for _, r := range lintRules {
+			fmt.Fprintf(stderr, "  %-26s %s\n", r.id, r.description)
+		}
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if *format != "text" && *format != "sarif" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	if len(fs.Args()) == 0 {
+		fs.Usage()
+		return fmt.Errorf("expected at least one rules file")
+	}
+
+	rules, err := loadRules(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	var findings []finding
+	for _, r := range rules {
+		findings = append(findings, lint(r, *scrapeInterval)...)
+	}
+
+	if *format == "sarif" {
+		if err := writeSARIF(stdout, findings); err != nil {
+			return err
+		}
+	} else {
+		for _, f := range findings {
+			fmt.Fprintf(stdout, "%s\n", f)
+		}
+	}
+
+	if len(findings) > 0 {
+		return fmt.Errorf("%d problems found", len(findings))
+	}
+
+	return nil
+}
+
+// writeSARIF writes the findings as a SARIF 2.1.0 log.
+func writeSARIF(w io.Writer, findings []finding) error {
+	type (
+		text struct {
+			Text string `json:"text"`
+		}
+		rule struct {
+			ID               string `json:"id"`
+			ShortDescription text   `json:"shortDescription"`
+		}
+		location struct {
+			PhysicalLocation struct {
+				ArtifactLocation struct {
+					URI string `json:"uri"`
+				} `json:"artifactLocation"`
+				Region struct {
+					StartLine int `json:"startLine"`
+				} `json:"region"`
+			} `json:"physicalLocation"`
+		}
+		result struct {
+			RuleID    string     `json:"ruleId"`
+			Level     string     `json:"level"`
+			Message   text       `json:"message"`
+			Locations []location `json:"locations"`
+		}
+	)
+
+	var (
+		rules   []rule
+		results = []result{}
+	)
+
+	for _, r := range lintRules {
+		rules = append(rules, rule{ID: r.id, ShortDescription: text{r.description}})
+	}
+
+	for _, f := range findings {
+		var loc location
+		loc.PhysicalLocation.ArtifactLocation.URI = f.file
+		loc.PhysicalLocation.Region.StartLine = max(f.line, 1)
+
+		results = append(results, result{
+			RuleID:    f.rule.id,
+			Level:     "warning",
+			Message:   text{fmt.Sprintf("%s/%s: %s", f.group, f.name, f.message)},
+			Locations: []location{loc},
+		})
+	}
+
+	log := map[string]any{
+		"version": "2.1.0",
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"runs": []any{
+			map[string]any{
+				"tool": map[string]any{
+					"driver": map[string]any{
+						"name":  "promalertmetrics",
+						"rules": rules,
+					},
+				},
+				"results": results,
+			},
+		},
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(log)
+}
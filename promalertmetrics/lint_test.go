@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+func TestLint(t *testing.T) {
+	// Every rule is the only rule of group g, starting on line 4.
+	tests := []struct {
+		name string
+		rule string
+		want []string
+	}{
+		{
+			name: "clean recording rule",
+			rule: `
+      - record: job:http_requests:rate5m
+        expr: sum by (job) (rate(http_requests_total{code=~"5.."}[5m]))`,
+		},
+		{
+			name: "rate over gauge with short range",
+			rule: `
+      - record: job:memory:rate1m
+        expr: |
+          sum by (job) (
+            rate(process_resident_memory_bytes[1m])
+          )`,
+			want: []string{
+				"7: rate-on-gauge: rate over process_resident_memory_bytes, which is not named like a counter",
+				"7: rate-range-too-short: rate range 1m is shorter than twice the scrape interval 1m",
+			},
+		},
+		{
+			name: "regex without regex syntax",
+			rule: `
+      - record: api:up
+        expr: up{job=~"api", env!~"dev"}`,
+			want: []string{
+				`5: regex-could-be-equality: job=~"api" can be job="api"`,
+				`5: regex-could-be-equality: env!~"dev" can be env!="dev"`,
+			},
+		},
+		{
+			name: "alert without for and annotations",
+			rule: `
+      - alert: Down
+        expr: up == 0`,
+			want: []string{
+				"4: alert-missing-for: alert has no for clause and fires on the first evaluation",
+				"4: alert-missing-annotation: alert has no summary annotation",
+				"4: alert-missing-annotation: alert has no runbook_url annotation",
+			},
+		},
+		{
+			name: "annotation label aggregated away",
+			rule: `
+      - alert: Down
+        expr: sum by (job) (up) == 0
+        for: 5m
+        annotations:
+          summary: "{{ $labels.job }} on {{ $labels.instance }} is down"
+          runbook_url: "https://runbooks/{{ .Labels.job }}"`,
+			want: []string{
+				"8: annotation-label-dropped: annotation summary uses label instance, which the expression drops",
+			},
+		},
+		{
+			name: "annotation label dropped by on in a filter comparison",
+			rule: `
+      - alert: Slow
+        expr: latency_seconds > on(job) latency_threshold_seconds
+        for: 5m
+        annotations:
+          summary: "{{ $labels.instance }} of {{ $labels.job }} is slow"
+          runbook_url: "https://runbooks/slow"`,
+			want: []string{
+				"8: annotation-label-dropped: annotation summary uses label instance, which the expression drops",
+			},
+		},
+		{
+			name: "annotation label dropped by ignoring",
+			rule: `
+      - alert: Slow
+        expr: latency_seconds > ignoring(instance) latency_threshold_seconds
+        for: 5m
+        annotations:
+          summary: "{{ $labels.instance }} of {{ $labels.job }} is slow"
+          runbook_url: "https://runbooks/slow"`,
+			want: []string{
+				"8: annotation-label-dropped: annotation summary uses label instance, which the expression drops",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.yml")
+			if err := os.WriteFile(path, []byte("groups:\n  - name: g\n    rules:"+tt.rule+"\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			rules, err := loadRules([]string{path})
+			if err != nil {
+				t.Fatalf("load rules: %v", err)
+			}
+			if len(rules) != 1 {
+				t.Fatalf("got %d rules, want 1", len(rules))
+			}
+
+			var got []string
+			for _, f := range lint(rules[0], time.Minute) {
+				if f.file != path || f.group != "g" || f.name != rules[0].name() {
+					t.Errorf("finding %v is not of rule g/%s in %s", f, rules[0].name(), path)
+				}
+				got = append(got, fmt.Sprintf("%d: %s: %s", f.line, f.rule.id, f.message))
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("findings mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestKeepsLabel(t *testing.T) {
+	tests := []struct {
+		expr  string
+		label string
+		want  bool
+	}{
+		{"up", "instance", true},
+		{"sum(up)", "instance", false},
+		{"sum by (instance) (up)", "instance", true},
+		{"sum without (instance) (up)", "instance", false},
+		{"sum without (instance) (up)", "job", true},
+		{"topk(3, sum by (job) (up))", "job", true},
+		{`count_values("version", build_info)`, "version", true},
+		{"up > 0", "instance", true},
+		{"up > on(job) threshold", "instance", false},
+		{"up > on(job) threshold", "job", true},
+		{"up > ignoring(instance) threshold", "instance", false},
+		{"up > ignoring(instance) threshold", "job", true},
+		{"up > bool on(job) threshold", "instance", false},
+		{"up * on(job) group_left(team) team_info", "team", true},
+		{"up * on(job) group_left(team) team_info", "instance", true},
+		{"up and on(job) threshold", "instance", true},
+		{"sum(up) or up", "instance", true},
+		{`label_replace(sum(up), "dst", "$1", "src", "(.*)")`, "dst", true},
+		{"vector(1)", "instance", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr+"/"+tt.label, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+
+			if got := keepsLabel(expr, tt.label); got != tt.want {
+				t.Errorf("keepsLabel(%s, %s) = %v, want %v", tt.expr, tt.label, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,15 +2,10 @@ package main
 
 import (
 	"context"
-	"errors"
 	"flag"
 	"fmt"
-	"log"
 	"os"
 	"os/signal"
-
-	"github.com/prometheus/prometheus/promql/parser"
-	"github.com/prometheus/prometheus/rules"
 )
 
 func main() {
@@ -35,10 +30,28 @@ func realMain(
 	stderr *os.File,
 	args []string,
 ) error {
+	if len(args) > 1 {
+		switch args[1] {
+		case "check":
+			return checkMain(stdout, stderr, args[1:])
+		case "graph":
+			return graphMain(stdout, stderr, args[1:])
+		case "test":
+			return testMain(stdout, stderr, args[1:])
+		case "lint":
+			return lintMain(stdout, stderr, args[1:])
+		}
+	}
+
 	fs := flag.NewFlagSet(args[0], flag.ExitOnError)
 	showFileNames := fs.Bool("f", false, "Show file names before each series")
+	format := fs.String("format", "text", "Output format: text, json or csv")
 	fs.Usage = func() {
 		fmt.Fprintf(stderr, "Usage: %s [options] <rules-files>\n", args[0])
+		fmt.Fprintf(stderr, "       %s check -catalog <file> <rules-files>\n", args[0])
+		fmt.Fprintf(stderr, "       %s graph [-format dot|json] <rules-files>\n", args[0])
+		fmt.Fprintf(stderr, "       %s test -t <test-file> [rules-files]\n", args[0])
+		fmt.Fprintf(stderr, "       %s lint [-format text|sarif] <rules-files>\n", args[0])
 		fs.PrintDefaults()
 	}
 
@@ -46,63 +59,32 @@ func realMain(
 		return err
 	}
 
+	switch *format {
+	case "text", "json", "csv":
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
 	if len(fs.Args()) == 0 {
 		fs.Usage()
 		return fmt.Errorf("expected at least one rules file")
 	}
 
-	filepaths := fs.Args()
-
-	type result struct {
-		file   string
-		series string
+	rules, err := loadRules(fs.Args())
+	if err != nil {
+		return err
 	}
 
-	var results []result
-
-	loader := rules.FileLoader{}
-	for _, path := range filepaths {
-		groups, errs := loader.Load(path, true)
-		if len(errs) > 0 {
-			return errors.Join(errs...)
-		}
-
-		for _, group := range groups.Groups {
-			for _, rule := range group.Rules {
-				expr, err := loader.Parse(rule.Expr)
-				if err != nil {
-					return fmt.Errorf("failed to parse expression %q: %w", rule.Expr, err)
-				}
-
-				parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
-					vs, ok := node.(*parser.VectorSelector)
-					if !ok {
-						return nil
-					}
-
-					if vs.Name == "" {
-						log.Fatalf("missing name: %v", rule.Alert)
-					}
-
-					results = append(results, result{
-						file:   path,
-						series: vs.Name,
-					})
-
-					return nil
-				})
-			}
-		}
+	inv := inventory(rules, stderr)
 
+	switch *format {
+	case "json":
+		return writeInventoryJSON(stdout, inv)
+	case "csv":
+		return writeInventoryCSV(stdout, inv)
 	}
 
-	for r := range results {
-		if *showFileNames {
-			fmt.Fprintf(stdout, "%v:\n  %v\n", results[r].file, results[r].series)
-		}
-
-		fmt.Fprintf(stdout, "%v\n", results[r].series)
-	}
+	writeInventoryText(stdout, inv, *showFileNames)
 
 	return nil
 }
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/rulefmt"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/rules"
+	"gopkg.in/yaml.v3"
+)
+
+// loadedRule is a rule of a rule file with its parsed expression.
+type loadedRule struct {
+	file  string
+	group string
+	rule  rulefmt.Rule
+	expr  parser.Expr
+	pos   rulePosition
+}
+
+// rulePosition is where a rule is in its file. Lines are 1-based, and 0
+// if unknown.
+type rulePosition struct {
+	// line is the line the rule starts at.
+	line int
+	// exprLine is the line the first line of the expression is on.
+	exprLine int
+	// annotationLines are the lines of the annotations by name.
+	annotationLines map[string]int
+}
+
+// name returns the alert name or recorded series of r.
+func (r loadedRule) name() string {
+	if r.rule.Alert != "" {
+		return r.rule.Alert
+	}
+	return r.rule.Record
+}
+
+func (r loadedRule) kind() string {
+	if r.rule.Alert != "" {
+		return "alert"
+	}
+	return "record"
+}
+
+// loadRules loads every rule of the rule files at paths, skipping paths
+// given more than once.
+func loadRules(paths []string) ([]loadedRule, error) {
+	var (
+		loader rules.FileLoader
+		loaded []loadedRule
+		seen   []string
+	)
+
+	for _, path := range paths {
+		if slices.Contains(seen, path) {
+			continue
+		}
+		seen = append(seen, path)
+
+		groups, errs := loader.Load(path, true)
+		if len(errs) > 0 {
+			return nil, errors.Join(errs...)
+		}
+
+		positions, err := rulePositions(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, group := range groups.Groups {
+			for j, rule := range group.Rules {
+				expr, err := loader.Parse(rule.Expr)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse expression %q: %w", rule.Expr, err)
+				}
+
+				loaded = append(loaded, loadedRule{
+					file:  path,
+					group: group.Name,
+					rule:  rule,
+					expr:  expr,
+					pos:   positions[[2]int{i, j}],
+				})
+			}
+		}
+	}
+
+	return loaded, nil
+}
+
+// rulePositions returns the position of every rule of the rule file at
+// path by the index of its group and its index in the group.
+func rulePositions(path string) (map[[2]int]rulePosition, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	positions := map[[2]int]rulePosition{}
+	if len(doc.Content) == 0 {
+		return positions, nil
+	}
+
+	groups := mappingValue(doc.Content[0], "groups")
+	if groups == nil {
+		return positions, nil
+	}
+
+	for i, group := range groups.Content {
+		rules := mappingValue(group, "rules")
+		if rules == nil {
+			continue
+		}
+
+		for j, rule := range rules.Content {
+			pos := rulePosition{line: rule.Line, annotationLines: map[string]int{}}
+
+			if expr := mappingValue(rule, "expr"); expr != nil {
+				pos.exprLine = expr.Line
+				// Block scalars start on the line after their header.
+				if expr.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+					pos.exprLine++
+				}
+			}
+
+			if annotations := mappingValue(rule, "annotations"); annotations != nil {
+				for k := 0; k+1 < len(annotations.Content); k += 2 {
+					pos.annotationLines[annotations.Content[k].Value] = annotations.Content[k].Line
+				}
+			}
+
+			positions[[2]int{i, j}] = pos
+		}
+	}
+
+	return positions, nil
+}
+
+// mappingValue returns the value of key in the mapping n, or nil.
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// selectors returns the vector selectors of expr, without duplicates.
+func selectors(expr parser.Expr) []*parser.VectorSelector {
+	var (
+		vss  []*parser.VectorSelector
+		seen = map[string]bool{}
+	)
+
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		vs, ok := node.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+
+		// Offsets and @ modifiers do not change the series read.
+		key := (&parser.VectorSelector{Name: vs.Name, LabelMatchers: vs.LabelMatchers}).String()
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+
+		vss = append(vss, vs)
+
+		return nil
+	})
+
+	return vss
+}
+
+// metricName returns the metric name vs selects, which is empty when it
+// selects series by their labels only.
+func metricName(vs *parser.VectorSelector) string {
+	if vs.Name != "" {
+		return vs.Name
+	}
+	for _, m := range vs.LabelMatchers {
+		if m.Name == labels.MetricName && m.Type == labels.MatchEqual {
+			return m.Value
+		}
+	}
+	return ""
+}
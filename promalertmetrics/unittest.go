@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/common/promslog"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"gopkg.in/yaml.v3"
+)
+
+// unitTestFile is a rule test file in the format of promtool test rules.
+// Only alert_rule_test cases are supported.
+type unitTestFile struct {
+	RuleFiles          []string       `yaml:"rule_files"`
+	EvaluationInterval model.Duration `yaml:"evaluation_interval"`
+	Tests              []testGroup    `yaml:"tests"`
+}
+
+type testGroup struct {
+	Name           string            `yaml:"name"`
+	Interval       model.Duration    `yaml:"interval"`
+	InputSeries    []series          `yaml:"input_series"`
+	AlertRuleTests []alertTestCase   `yaml:"alert_rule_test"`
+	ExternalLabels map[string]string `yaml:"external_labels"`
+	ExternalURL    string            `yaml:"external_url"`
+}
+
+type series struct {
+	Series string `yaml:"series"`
+	Values string `yaml:"values"`
+}
+
+type alertTestCase struct {
+	EvalTime  model.Duration `yaml:"eval_time"`
+	Alertname string         `yaml:"alertname"`
+	ExpAlerts []alert        `yaml:"exp_alerts"`
+}
+
+type alert struct {
+	ExpLabels      map[string]string `yaml:"exp_labels"`
+	ExpAnnotations map[string]string `yaml:"exp_annotations"`
+}
+
+// testMain runs the alert tests of a test file against the rule files.
+func testMain(
+	stdout *os.File,
+	stderr *os.File,
+	args []string,
+) error {
+	fs := flag.NewFlagSet(args[0], flag.ExitOnError)
+	testPath := fs.String("t", "", "Test file in promtool's format")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s -t <test-file> [rules-files]\n", args[0])
+		fmt.Fprintf(stderr, "Rule files default to the rule_files of the test file.\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if *testPath == "" {
+		fs.Usage()
+		return fmt.Errorf("expected a test file")
+	}
+
+	b, err := os.ReadFile(*testPath)
+	if err != nil {
+		return err
+	}
+
+	var utf unitTestFile
+	if err := yaml.Unmarshal(b, &utf); err != nil {
+		return fmt.Errorf("%s: %w", *testPath, err)
+	}
+
+	ruleFiles := fs.Args()
+	if len(ruleFiles) == 0 {
+		for _, f := range utf.RuleFiles {
+			if !filepath.IsAbs(f) {
+				f = filepath.Join(filepath.Dir(*testPath), f)
+			}
+			ruleFiles = append(ruleFiles, f)
+		}
+	}
+	if len(ruleFiles) == 0 {
+		return fmt.Errorf("expected at least one rules file")
+	}
+
+	// Fail on rules that do not parse before setting up storage.
+	if _, err := loadRules(ruleFiles); err != nil {
+		return err
+	}
+
+	evalInterval := time.Duration(utf.EvaluationInterval)
+	if evalInterval == 0 {
+		evalInterval = time.Minute
+	}
+
+	var failed int
+	for i, tg := range utf.Tests {
+		name := tg.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		errs := tg.run(evalInterval, ruleFiles)
+		if len(errs) == 0 {
+			fmt.Fprintf(stdout, "ok   %s\n", name)
+			continue
+		}
+
+		failed++
+		fmt.Fprintf(stdout, "FAIL %s\n", name)
+		for _, err := range errs {
+			fmt.Fprintf(stdout, "%s\n", indent(err.Error(), "    "))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tests failed", failed, len(utf.Tests))
+	}
+
+	return nil
+}
+
+// run evaluates the rules every evalInterval from 0 to the last eval_time
+// and compares the firing alerts at every eval_time with the expected ones.
+func (tg *testGroup) run(evalInterval time.Duration, ruleFiles []string) []error {
+	interval := time.Duration(tg.Interval)
+	if interval == 0 {
+		interval = evalInterval
+	}
+
+	ctx := context.Background()
+
+	stor, err := openStorage()
+	if err != nil {
+		return []error{err}
+	}
+	defer stor.Close()
+
+	if err := tg.load(ctx, stor, interval); err != nil {
+		return []error{err}
+	}
+
+	engine := promql.NewEngine(promql.EngineOpts{
+		Logger:                   promslog.NewNopLogger(),
+		MaxSamples:               50000000,
+		Timeout:                  100 * time.Second,
+		NoStepSubqueryIntervalFn: func(int64) int64 { return evalInterval.Milliseconds() },
+		EnableAtModifier:         true,
+		EnableNegativeOffset:     true,
+	})
+
+	m := rules.NewManager(&rules.ManagerOptions{
+		QueryFunc:  rules.EngineQueryFunc(engine, stor),
+		Appendable: stor,
+		Queryable:  stor,
+		Context:    ctx,
+		NotifyFunc: func(context.Context, string, ...*rules.Alert) {},
+		Logger:     promslog.NewNopLogger(),
+	})
+
+	groupsMap, errs := m.LoadGroups(interval, labels.FromMap(tg.ExternalLabels), tg.ExternalURL, nil, true, ruleFiles...)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	// Evaluate groups in the order of the files, as Prometheus does.
+	groups := make([]*rules.Group, 0, len(groupsMap))
+	for _, g := range groupsMap {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		fi, fj := slices.Index(ruleFiles, groups[i].File()), slices.Index(ruleFiles, groups[j].File())
+		if fi != fj {
+			return fi < fj
+		}
+		return groups[i].Name() < groups[j].Name()
+	})
+
+	for _, g := range groups {
+		for _, r := range g.Rules() {
+			// Mark alerts as restored so they fire without waiting for
+			// their state to be restored from storage.
+			if ar, ok := r.(*rules.AlertingRule); ok {
+				ar.SetRestored(true)
+			}
+		}
+	}
+
+	tests := slices.Clone(tg.AlertRuleTests)
+	sort.SliceStable(tests, func(i, j int) bool { return tests[i].EvalTime < tests[j].EvalTime })
+
+	for _, tc := range tests {
+		if tc.Alertname == "" {
+			return []error{fmt.Errorf("alert_rule_test at eval_time %s has no alertname", tc.EvalTime)}
+		}
+	}
+
+	var (
+		mint = time.Unix(0, 0).UTC()
+		next int
+	)
+
+	for ts := mint; next < len(tests); ts = ts.Add(evalInterval) {
+		var evalErrs []error
+		for _, g := range groups {
+			g.Eval(ctx, ts)
+			for _, r := range g.Rules() {
+				if err := r.LastError(); err != nil {
+					evalErrs = append(evalErrs, fmt.Errorf("rule %s at %s: %w", r.Name(), ts.Sub(mint), err))
+				}
+			}
+		}
+		if len(evalErrs) > 0 {
+			return append(errs, evalErrs...)
+		}
+
+		// An eval_time between two evaluations is checked against the
+		// earlier one.
+		for ; next < len(tests) && time.Duration(tests[next].EvalTime) < ts.Add(evalInterval).Sub(mint); next++ {
+			tc := tests[next]
+			got := firingAlerts(groups, tc.Alertname)
+			exp := tc.expected()
+
+			if diff := diffAlerts(exp, got); diff != "" {
+				errs = append(errs, fmt.Errorf("alertname: %s, time: %s\n%s", tc.Alertname, tc.EvalTime, diff))
+			}
+		}
+	}
+
+	return errs
+}
+
+// tempStorage is a TSDB in a temporary directory that is removed on Close.
+type tempStorage struct {
+	*tsdb.DB
+	dir string
+}
+
+// openStorage opens a TSDB in a new temporary directory for the input
+// series of a test group and the samples its rules write.
+func openStorage() (*tempStorage, error) {
+	dir, err := os.MkdirTemp("", "promalertmetrics")
+	if err != nil {
+		return nil, err
+	}
+
+	// Input series are loaded sequentially from time 0, so blocks must
+	// not be cut or dropped by retention while a test runs.
+	opts := tsdb.DefaultOptions()
+	opts.MinBlockDuration = (24 * time.Hour).Milliseconds()
+	opts.MaxBlockDuration = (24 * time.Hour).Milliseconds()
+	opts.RetentionDuration = 0
+	opts.EnableNativeHistograms = true
+
+	db, err := tsdb.Open(dir, promslog.NewNopLogger(), nil, opts, nil)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	return &tempStorage{DB: db, dir: dir}, nil
+}
+
+func (s *tempStorage) Close() error {
+	err := s.DB.Close()
+	if rmErr := os.RemoveAll(s.dir); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// load appends the input series to stor, with the nth value of every
+// series at n*interval.
+func (tg *testGroup) load(ctx context.Context, stor storage.Appendable, interval time.Duration) error {
+	app := stor.Appender(ctx)
+
+	for _, s := range tg.InputSeries {
+		lbls, values, err := parser.ParseSeriesDesc(s.Series + " " + s.Values)
+		if err != nil {
+			return fmt.Errorf("input series %s: %w", s.Series, err)
+		}
+
+		for i, v := range values {
+			if v.Omitted {
+				continue
+			}
+
+			ts := int64(i) * interval.Milliseconds()
+			if v.Histogram != nil {
+				_, err = app.AppendHistogram(0, lbls, ts, nil, v.Histogram)
+			} else {
+				_, err = app.Append(0, lbls, ts, v.Value)
+			}
+			if err != nil {
+				_ = app.Rollback()
+				return fmt.Errorf("input series %s: %w", s.Series, err)
+			}
+		}
+	}
+
+	return app.Commit()
+}
+
+func (tc alertTestCase) expected() []string {
+	exp := make([]string, 0, len(tc.ExpAlerts))
+	for _, a := range tc.ExpAlerts {
+		lbls := map[string]string{labels.AlertName: tc.Alertname}
+		for k, v := range a.ExpLabels {
+			lbls[k] = v
+		}
+		exp = append(exp, alertString(labels.FromMap(lbls), labels.FromMap(a.ExpAnnotations)))
+	}
+	sort.Strings(exp)
+	return exp
+}
+
+// firingAlerts returns the firing alerts of the alerting rules named name
+// in every group.
+func firingAlerts(groups []*rules.Group, name string) []string {
+	var got []string
+	for _, g := range groups {
+		for _, ar := range g.AlertingRules() {
+			if ar.Name() != name {
+				continue
+			}
+			for _, a := range ar.ActiveAlerts() {
+				if a.State == rules.StateFiring {
+					got = append(got, alertString(a.Labels, a.Annotations))
+				}
+			}
+		}
+	}
+	sort.Strings(got)
+	return got
+}
+
+func alertString(lbls, annotations labels.Labels) string {
+	if annotations.IsEmpty() {
+		return lbls.String()
+	}
+	return lbls.String() + " " + annotations.String()
+}
+
+// diffAlerts returns the alerts only expected prefixed by "-" and the
+// alerts only firing prefixed by "+", or "" if they are the same.
+func diffAlerts(exp, got []string) string {
+	var lines []string
+	for _, a := range exp {
+		if i := slices.Index(got, a); i >= 0 {
+			got = slices.Delete(slices.Clone(got), i, i+1)
+			continue
+		}
+		lines = append(lines, "- "+a)
+	}
+	for _, a := range got {
+		lines = append(lines, "+ "+a)
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+
+	return "  (- expected, + firing)\n  " + strings.Join(lines, "\n  ")
+}
+
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
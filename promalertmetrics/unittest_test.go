@@ -0,0 +1,178 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+const unitTestRules = `groups:
+  - name: g
+    rules:
+      - record: job:errors:rate2m
+        expr: sum by (job) (rate(errors_total[2m]))
+      - alert: HighErrors
+        expr: job:errors:rate2m > 0.5
+        for: 2m
+        labels:
+          severity: page
+        annotations:
+          summary: "{{ $labels.job }} errors"
+`
+
+func TestTestGroupRun(t *testing.T) {
+	tests := []struct {
+		name  string
+		group string
+		want  []string
+	}{
+		{
+			name: "pending then firing and still firing later",
+			group: `
+input_series:
+  - series: 'errors_total{job="api"}'
+    values: '0+60x20'
+  - series: 'errors_total{job="web"}'
+    values: '0+1x20'
+alert_rule_test:
+  - eval_time: 2m
+    alertname: HighErrors
+  - eval_time: 4m
+    alertname: HighErrors
+    exp_alerts:
+      - exp_labels: {job: api, severity: page}
+        exp_annotations: {summary: api errors}
+  - eval_time: 15m
+    alertname: HighErrors
+    exp_alerts:
+      - exp_labels: {job: api, severity: page}
+        exp_annotations: {summary: api errors}
+`,
+		},
+		{
+			name: "eval_time between evaluations",
+			group: `
+interval: 30s
+input_series:
+  - series: 'errors_total{job="api"}'
+    values: '0+30x40'
+alert_rule_test:
+  - eval_time: 4m30s
+    alertname: HighErrors
+    exp_alerts:
+      - exp_labels: {job: api, severity: page}
+        exp_annotations: {summary: api errors}
+`,
+		},
+		{
+			name: "resolved alert",
+			group: `
+input_series:
+  - series: 'errors_total{job="api"}'
+    values: '0+60x5 300x10'
+alert_rule_test:
+  - eval_time: 4m
+    alertname: HighErrors
+    exp_alerts:
+      - exp_labels: {job: api, severity: page}
+        exp_annotations: {summary: api errors}
+  - eval_time: 10m
+    alertname: HighErrors
+`,
+		},
+		{
+			name: "missing and unexpected alerts",
+			group: `
+input_series:
+  - series: 'errors_total{job="api"}'
+    values: '0+60x20'
+alert_rule_test:
+  - eval_time: 1m
+    alertname: HighErrors
+    exp_alerts:
+      - exp_labels: {job: api, severity: page}
+        exp_annotations: {summary: api errors}
+  - eval_time: 10m
+    alertname: HighErrors
+    exp_alerts:
+      - exp_labels: {job: web, severity: page}
+`,
+			want: []string{
+				"alertname: HighErrors, time: 1m\n" +
+					"  (- expected, + firing)\n" +
+					`  - {alertname="HighErrors", job="api", severity="page"} {summary="api errors"}`,
+				"alertname: HighErrors, time: 10m\n" +
+					"  (- expected, + firing)\n" +
+					`  - {alertname="HighErrors", job="web", severity="page"}` + "\n" +
+					`  + {alertname="HighErrors", job="api", severity="page"} {summary="api errors"}`,
+			},
+		},
+		{
+			name: "missing alertname",
+			group: `
+alert_rule_test:
+  - eval_time: 1m
+`,
+			want: []string{"alert_rule_test at eval_time 1m has no alertname"},
+		},
+		{
+			name: "invalid input series",
+			group: `
+input_series:
+  - series: 'errors_total{job="api"'
+    values: '1'
+`,
+			want: []string{`input series errors_total{job="api": 1:24: parse error: unexpected character inside braces: '1'`},
+		},
+	}
+
+	ruleFile := filepath.Join(t.TempDir(), "rules.yml")
+	if err := os.WriteFile(ruleFile, []byte(unitTestRules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tg testGroup
+			if err := yaml.Unmarshal([]byte(tt.group), &tg); err != nil {
+				t.Fatalf("unmarshal test group: %v", err)
+			}
+
+			var got []string
+			for _, err := range tg.run(time.Minute, []string{ruleFile}) {
+				got = append(got, err.Error())
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("errors mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDiffAlerts(t *testing.T) {
+	tests := []struct {
+		name string
+		exp  []string
+		got  []string
+		want string
+	}{
+		{"same", []string{"a", "b"}, []string{"a", "b"}, ""},
+		{"both empty", nil, nil, ""},
+		{"missing", []string{"a", "b"}, []string{"a"}, "  (- expected, + firing)\n  - b"},
+		{"unexpected", nil, []string{"a"}, "  (- expected, + firing)\n  + a"},
+		{"duplicate expected once", []string{"a", "a"}, []string{"a"}, "  (- expected, + firing)\n  - a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffAlerts(tt.exp, tt.got); got != tt.want {
+				t.Errorf("diffAlerts(%q, %q) = %q, want %q", tt.exp, tt.got, got, tt.want)
+			}
+		})
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/promql/parser"
 )
@@ -31,6 +33,13 @@ func realMain(
 	stdout io.Writer,
 	args []string,
 ) error {
+	if len(args) > 1 {
+		switch args[1] {
+		case opSet, opAdd, opDrop:
+			return rewriteMain(args[1], stdin, stdout, args[1:])
+		}
+	}
+
 	fs := flag.NewFlagSet("promlabels", flag.ExitOnError)
 	flagJSON := fs.Bool("json", false, "output in JSON format")
 
@@ -40,26 +49,31 @@ func realMain(
 
 	scanner := bufio.NewScanner(stdin)
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		metricselector, err := parser.ParseMetricSelector(line)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		expr, err := parser.ParseExpr(text)
 		if err != nil {
-			return fmt.Errorf("parse-metric-selector: %w", err)
+			return fmt.Errorf("line %d: parse-expr: %w", line, err)
 		}
 
-		for _, matcher := range metricselector {
-			if *flagJSON {
-				m := (*Matcher)(matcher)
-				b, err := json.Marshal(m)
-				if err != nil {
-					return err
+		for _, sel := range selectors(expr, line) {
+			for _, m := range sel.Matchers {
+				if *flagJSON {
+					b, err := json.Marshal(sel.record(m))
+					if err != nil {
+						return err
+					}
+
+					fmt.Fprintf(stdout, "%s\n", b)
+					continue
 				}
 
-				fmt.Fprintf(stdout, "%s\n", b)
-				continue
+				fmt.Fprintf(stdout, "%s\n", sel.format(m))
 			}
-
-			fmt.Fprintf(stdout, "%s\n", matcher)
 		}
 	}
 
@@ -70,18 +84,113 @@ func realMain(
 	return nil
 }
 
-type Matcher labels.Matcher
-
-func (m Matcher) MarshalJSON() ([]byte, error) {
-	b, err := json.Marshal(struct {
-		Name  string `json:"name"`
-		Value string `json:"value"`
-		Type  string `json:"type"`
-	}{
-		Type:  m.Type.String(),
-		Name:  m.Name,
-		Value: m.Value,
+// Selector is a vector or range selector of a query.
+type Selector struct {
+	Metric   string
+	Matchers []*labels.Matcher
+	Line     int
+	// Start and End are the byte offsets of the selector in its line.
+	Start  int
+	End    int
+	Range  string
+	Offset string
+}
+
+// format returns m followed by the position, metric name, range and
+// offset of s, separated by tabs. The metric name, range and offset are
+// only present if set.
+func (s Selector) format(m *labels.Matcher) string {
+	fields := []string{
+		m.String(),
+		fmt.Sprintf("%d:%d", s.Line, s.Start+1),
+	}
+	if s.Metric != "" {
+		fields = append(fields, "metric="+s.Metric)
+	}
+	if s.Range != "" {
+		fields = append(fields, "range="+s.Range)
+	}
+	if s.Offset != "" {
+		fields = append(fields, "offset="+s.Offset)
+	}
+
+	return strings.Join(fields, "\t")
+}
+
+// matcherRecord is a matcher in -json output, with the selector it is
+// part of.
+type matcherRecord struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Type   string `json:"type"`
+	Metric string `json:"metric,omitempty"`
+	Line   int    `json:"line"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Range  string `json:"range,omitempty"`
+	Offset string `json:"offset,omitempty"`
+}
+
+func (s Selector) record(m *labels.Matcher) matcherRecord {
+	return matcherRecord{
+		Name:   m.Name,
+		Value:  m.Value,
+		Type:   m.Type.String(),
+		Metric: s.Metric,
+		Line:   s.Line,
+		Start:  s.Start,
+		End:    s.End,
+		Range:  s.Range,
+		Offset: s.Offset,
+	}
+}
+
+// selectors returns every vector and range selector of expr, which was
+// read from line.
+func selectors(expr parser.Expr, line int) []Selector {
+	var sels []Selector
+
+	parser.Inspect(expr, func(node parser.Node, path []parser.Node) error {
+		var (
+			vs  *parser.VectorSelector
+			sel Selector
+		)
+
+		switch n := node.(type) {
+		case *parser.MatrixSelector:
+			vs = n.VectorSelector.(*parser.VectorSelector)
+			sel.Range = model.Duration(n.Range).String()
+		case *parser.VectorSelector:
+			// Range selectors were reported with their vector selector.
+			if len(path) > 0 {
+				if _, ok := path[len(path)-1].(*parser.MatrixSelector); ok {
+					return nil
+				}
+			}
+			vs = n
+		default:
+			return nil
+		}
+
+		pos := node.PositionRange()
+		sel.Line = line
+		sel.Start = int(pos.Start)
+		sel.End = int(pos.End)
+		sel.Metric = vs.Name
+
+		switch {
+		case vs.OriginalOffset > 0:
+			sel.Offset = model.Duration(vs.OriginalOffset).String()
+		case vs.OriginalOffset < 0:
+			sel.Offset = "-" + model.Duration(-vs.OriginalOffset).String()
+		}
+
+		sel.Matchers = vs.LabelMatchers
+
+		sels = append(sels, sel)
+
+		return nil
 	})
 
-	return b, err
+	return sels
 }
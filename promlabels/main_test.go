@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+func TestSelectors(t *testing.T) {
+	type selector struct {
+		Metric   string
+		Matchers []string
+		Start    int
+		End      int
+		Range    string
+		Offset   string
+	}
+
+	tests := []struct {
+		expr string
+		want []selector
+	}{
+		{
+			expr: `up{job="api"}`,
+			want: []selector{
+				{Metric: "up", Matchers: []string{`job="api"`, `__name__="up"`}, End: 13},
+			},
+		},
+		{
+			expr: `sum by (job) (rate(http_requests_total{code=~"5.."}[5m] offset 1h)) / on(job) group_left {__name__="up"}`,
+			want: []selector{
+				{
+					Metric:   "http_requests_total",
+					Matchers: []string{`code=~"5.."`, `__name__="http_requests_total"`},
+					Start:    19,
+					End:      65,
+					Range:    "5m",
+					Offset:   "1h",
+				},
+				{Matchers: []string{`__name__="up"`}, Start: 89, End: 104},
+			},
+		},
+		{
+			expr: `max_over_time(up[1h:5m] offset -5m)`,
+			want: []selector{
+				{Metric: "up", Matchers: []string{`__name__="up"`}, Start: 14, End: 16},
+			},
+		},
+		{
+			expr: `foo offset -5m`,
+			want: []selector{
+				{Metric: "foo", Matchers: []string{`__name__="foo"`}, End: 14, Offset: "-5m"},
+			},
+		},
+		{
+			expr: `vector(1) + time()`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+
+			var got []selector
+			for _, s := range selectors(expr, 3) {
+				if s.Line != 3 {
+					t.Errorf("selector %+v: line = %d, want 3", s, s.Line)
+				}
+
+				got = append(got, selector{
+					Metric:   s.Metric,
+					Matchers: matcherStrings(s.Matchers),
+					Start:    s.Start,
+					End:      s.End,
+					Range:    s.Range,
+					Offset:   s.Offset,
+				})
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("selectors mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRealMain(t *testing.T) {
+	const input = `rate(http_requests_total{code="500"}[5m])
+
+up{job=~"api|web"} offset 1h
+`
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "text",
+			want: "code=\"500\"\t1:6\tmetric=http_requests_total\trange=5m\n" +
+				"__name__=\"http_requests_total\"\t1:6\tmetric=http_requests_total\trange=5m\n" +
+				"job=~\"api|web\"\t3:1\tmetric=up\toffset=1h\n" +
+				"__name__=\"up\"\t3:1\tmetric=up\toffset=1h\n",
+		},
+		{
+			name: "json",
+			args: []string{"-json"},
+			want: `{"name":"code","value":"500","type":"=","metric":"http_requests_total","line":1,"start":5,"end":40,"range":"5m"}` + "\n" +
+				`{"name":"__name__","value":"http_requests_total","type":"=","metric":"http_requests_total","line":1,"start":5,"end":40,"range":"5m"}` + "\n" +
+				`{"name":"job","value":"api|web","type":"=~","metric":"up","line":3,"start":0,"end":28,"offset":"1h"}` + "\n" +
+				`{"name":"__name__","value":"up","type":"=","metric":"up","line":3,"start":0,"end":28,"offset":"1h"}` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			args := append([]string{"promlabels"}, tt.args...)
+			if err := realMain(t.Context(), strings.NewReader(input), &stdout, args); err != nil {
+				t.Fatalf("realMain: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, stdout.String()); diff != "" {
+				t.Errorf("output mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRealMainParseError(t *testing.T) {
+	err := realMain(t.Context(), strings.NewReader("up\nsum(\n"), &bytes.Buffer{}, []string{"promlabels"})
+	if err == nil || !strings.HasPrefix(err.Error(), "line 2: parse-expr: ") {
+		t.Errorf("realMain error = %v, want a parse error on line 2", err)
+	}
+}
+
+// matcherStrings returns the matchers as strings, for comparing.
+func matcherStrings(ms []*labels.Matcher) []string {
+	var out []string
+	for _, m := range ms {
+		out = append(out, m.String())
+	}
+	return out
+}
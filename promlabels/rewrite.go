@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+const (
+	opSet  = "set"
+	opAdd  = "add"
+	opDrop = "drop"
+)
+
+// rewriteMain rewrites the matchers of every selector of the queries read
+// from stdin, one per line, and prints the rewritten queries.
+func rewriteMain(op string, stdin io.Reader, stdout io.Writer, args []string) error {
+	fs := flag.NewFlagSet("promlabels "+op, flag.ExitOnError)
+	fs.Usage = func() {
+		switch op {
+		case opDrop:
+			fmt.Fprintf(fs.Output(), "usage: promlabels drop <label> ... < queries\n\n")
+			fmt.Fprintf(fs.Output(), "Removes every matcher on the labels from every selector.\n")
+		case opAdd:
+			fmt.Fprintf(fs.Output(), "usage: promlabels add <matcher> ... < queries\n\n")
+			fmt.Fprintf(fs.Output(), "Adds the matchers, e.g. 'cluster=\"prod\"', to every selector\n")
+			fmt.Fprintf(fs.Output(), "that has no matcher on their label yet.\n")
+		default:
+			fmt.Fprintf(fs.Output(), "usage: promlabels set <matcher> ... < queries\n\n")
+			fmt.Fprintf(fs.Output(), "Sets the matchers, e.g. 'cluster=\"prod\"', on every selector,\n")
+			fmt.Fprintf(fs.Output(), "replacing any matchers on their label.\n")
+		}
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("%s: no labels given", op)
+	}
+
+	var rewrite func(*parser.VectorSelector)
+	if op == opDrop {
+		names := fs.Args()
+		rewrite = func(vs *parser.VectorSelector) {
+			vs.LabelMatchers = slices.DeleteFunc(vs.LabelMatchers, func(m *labels.Matcher) bool {
+				return slices.Contains(names, m.Name)
+			})
+		}
+	} else {
+		matchers, err := parser.ParseMetricSelector("{" + strings.Join(fs.Args(), ",") + "}")
+		if err != nil {
+			return fmt.Errorf("parse-matchers: %w", err)
+		}
+
+		rewrite = func(vs *parser.VectorSelector) {
+			for _, m := range matchers {
+				has := slices.ContainsFunc(vs.LabelMatchers, func(o *labels.Matcher) bool {
+					return o.Name == m.Name
+				})
+				if has && op == opAdd {
+					continue
+				}
+				if has {
+					vs.LabelMatchers = slices.DeleteFunc(vs.LabelMatchers, func(o *labels.Matcher) bool {
+						return o.Name == m.Name
+					})
+				}
+				vs.LabelMatchers = append(vs.LabelMatchers, m)
+			}
+		}
+	}
+
+	scanner := bufio.NewScanner(stdin)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		expr, err := parser.ParseExpr(text)
+		if err != nil {
+			return fmt.Errorf("line %d: parse-expr: %w", line, err)
+		}
+
+		if err := rewriteSelectors(expr, rewrite); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		fmt.Fprintf(stdout, "%s\n", expr)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// rewriteSelectors calls rewrite with every vector selector of expr,
+// including those of range selectors.
+func rewriteSelectors(expr parser.Expr, rewrite func(*parser.VectorSelector)) error {
+	var err error
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		vs, ok := node.(*parser.VectorSelector)
+		if !ok || err != nil {
+			return nil
+		}
+
+		orig := vs.String()
+		rewrite(vs)
+
+		// The metric name is printed from Name rather than the matchers,
+		// so keep it in sync with any change to the __name__ matcher.
+		vs.Name = ""
+		for _, m := range vs.LabelMatchers {
+			if m.Name == labels.MetricName && m.Type == labels.MatchEqual {
+				vs.Name = m.Value
+			}
+		}
+
+		if !slices.ContainsFunc(vs.LabelMatchers, func(m *labels.Matcher) bool { return !m.Matches("") }) {
+			err = fmt.Errorf("selector %s would match every series", orig)
+		}
+
+		return nil
+	})
+
+	return err
+}
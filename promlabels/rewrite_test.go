@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRewriteMain(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		input   string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "set replaces matchers on the label",
+			args:  []string{opSet, `cluster="prod"`},
+			input: `sum(rate(http_requests_total{cluster=~"dev|stage", job="api"}[5m])) / sum(up)`,
+			want:  `sum(rate(http_requests_total{cluster="prod",job="api"}[5m])) / sum(up{cluster="prod"})` + "\n",
+		},
+		{
+			name:  "add keeps existing matchers on the label",
+			args:  []string{opAdd, `cluster="prod"`, `env!="test"`},
+			input: `up{cluster="dev"} or node_load1`,
+			want:  `up{cluster="dev",env!="test"} or node_load1{cluster="prod",env!="test"}` + "\n",
+		},
+		{
+			name:  "drop removes every matcher on the labels",
+			args:  []string{opDrop, "cluster", "env"},
+			input: `rate(foo{cluster="a", env=~"x.*", job="j"}[1m] offset 5m)`,
+			want:  `rate(foo{job="j"}[1m] offset 5m)` + "\n",
+		},
+		{
+			name:  "set metric name",
+			args:  []string{opSet, `__name__="node_load5"`},
+			input: `node_load1{instance="a"}`,
+			want:  `node_load5{instance="a"}` + "\n",
+		},
+		{
+			name: "one query per line",
+			args: []string{opAdd, `cluster="prod"`},
+			input: `up
+
+foo[5m]
+`,
+			want: `up{cluster="prod"}` + "\n" + `foo{cluster="prod"}[5m]` + "\n",
+		},
+		{
+			name:    "drop leaving a selector matching every series",
+			args:    []string{opDrop, "job"},
+			input:   "up\n{job=\"api\"}\n",
+			want:    `up` + "\n",
+			wantErr: `line 2: selector {job="api"} would match every series`,
+		},
+		{
+			name:    "invalid matcher",
+			args:    []string{opSet, "cluster"},
+			input:   "up\n",
+			wantErr: "parse-matchers: ",
+		},
+		{
+			name:    "invalid query",
+			args:    []string{opAdd, `cluster="prod"`},
+			input:   "sum(\n",
+			wantErr: "line 1: parse-expr: ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := realMain(t.Context(), strings.NewReader(tt.input), &stdout, append([]string{"promlabels"}, tt.args...))
+
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("realMain: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.wantErr)):
+				t.Fatalf("realMain error = %v, want %q", err, tt.wantErr)
+			}
+
+			if diff := cmp.Diff(tt.want, stdout.String()); diff != "" {
+				t.Errorf("output mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
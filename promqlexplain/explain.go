@@ -0,0 +1,736 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// explanation is a step-by-step explanation of an expression.
+type explanation struct {
+	steps  []string
+	result string
+}
+
+// explain returns the explanation of expr. Steps are in the order the
+// expression is evaluated, innermost first.
+func explain(expr parser.Expr) explanation {
+	var x explainer
+	res := x.explain(expr)
+
+	var result string
+	switch expr.Type() {
+	case parser.ValueTypeVector:
+		result = "an instant vector: one value per series, " + res.labels.String()
+	case parser.ValueTypeMatrix:
+		result = "a range vector: a range of samples per series, " + res.labels.String()
+	case parser.ValueTypeScalar:
+		result = "a single number without labels"
+	case parser.ValueTypeString:
+		result = "a string"
+	}
+
+	return explanation{steps: x.steps, result: result}
+}
+
+type explainer struct {
+	steps []string
+}
+
+// operand is an explained subexpression.
+type operand struct {
+	// ref is how later steps refer to the operand, e.g. "the result of
+	// step 2" or a number.
+	ref    string
+	labels labelSet
+}
+
+func (x *explainer) step(format string, args ...any) string {
+	x.steps = append(x.steps, fmt.Sprintf(format, args...))
+	return fmt.Sprintf("the result of step %d", len(x.steps))
+}
+
+func (x *explainer) explain(expr parser.Expr) operand {
+	switch e := expr.(type) {
+	case *parser.NumberLiteral:
+		return operand{ref: strconv.FormatFloat(e.Val, 'g', -1, 64)}
+
+	case *parser.StringLiteral:
+		return operand{ref: strconv.Quote(e.Val)}
+
+	case *parser.ParenExpr:
+		return x.explain(e.Expr)
+
+	case *parser.StepInvariantExpr:
+		return x.explain(e.Expr)
+
+	case *parser.VectorSelector:
+		ref := x.step("Select %s, taking the latest sample of each series from the last 5m%s.",
+			describeSelector(e), describeModifiers(e))
+		return operand{ref: ref, labels: labelSet{}}
+
+	case *parser.MatrixSelector:
+		vs := e.VectorSelector.(*parser.VectorSelector)
+		ref := x.step("Select %s, taking every sample of each series from the last %s%s.",
+			describeSelector(vs), model.Duration(e.Range), describeModifiers(vs))
+		return operand{ref: ref, labels: labelSet{}}
+
+	case *parser.SubqueryExpr:
+		inner := x.explain(e.Expr)
+		step := "the default evaluation interval"
+		if e.Step != 0 {
+			step = model.Duration(e.Step).String()
+		}
+		ref := x.step("Evaluate %s every %s over the last %s%s, giving a range of values per series.",
+			inner.ref, step, model.Duration(e.Range), describeOffset(e.OriginalOffset, e.Timestamp, e.StartOrEnd))
+		return operand{ref: ref, labels: inner.labels}
+
+	case *parser.UnaryExpr:
+		inner := x.explain(e.Expr)
+		if e.Op == parser.ADD {
+			return inner
+		}
+		ref := x.step("Negate every value of %s.", inner.ref)
+		return operand{ref: ref, labels: inner.labels.withoutName()}
+
+	case *parser.Call:
+		return x.explainCall(e)
+
+	case *parser.AggregateExpr:
+		return x.explainAggregate(e)
+
+	case *parser.BinaryExpr:
+		return x.explainBinary(e)
+	}
+
+	return operand{ref: x.step("Evaluate %s.", expr)}
+}
+
+// describeSelector describes the series a selector selects.
+func describeSelector(vs *parser.VectorSelector) string {
+	var (
+		name  string
+		conds []string
+	)
+
+	for _, m := range vs.LabelMatchers {
+		if m.Name == labels.MetricName && m.Type == labels.MatchEqual {
+			name = m.Value
+			continue
+		}
+
+		label := "label " + m.Name
+		if m.Name == labels.MetricName {
+			label = "the metric name"
+		}
+
+		switch m.Type {
+		case labels.MatchEqual:
+			if m.Value == "" {
+				conds = append(conds, label+" is not set")
+			} else {
+				conds = append(conds, fmt.Sprintf("%s is %q", label, m.Value))
+			}
+		case labels.MatchNotEqual:
+			if m.Value == "" {
+				conds = append(conds, label+" is set")
+			} else {
+				conds = append(conds, fmt.Sprintf("%s is not %q", label, m.Value))
+			}
+		case labels.MatchRegexp:
+			conds = append(conds, fmt.Sprintf("%s fully matches the regex %q", label, m.Value))
+		case labels.MatchNotRegexp:
+			conds = append(conds, fmt.Sprintf("%s does not match the regex %q", label, m.Value))
+		}
+	}
+
+	var b strings.Builder
+	if name != "" {
+		fmt.Fprintf(&b, "the series of metric %s", name)
+	} else {
+		b.WriteString("all series")
+	}
+	if len(conds) > 0 {
+		b.WriteString(" where ")
+		b.WriteString(joinAnd(conds))
+	}
+
+	return b.String()
+}
+
+func describeModifiers(vs *parser.VectorSelector) string {
+	return describeOffset(vs.OriginalOffset, vs.Timestamp, vs.StartOrEnd)
+}
+
+func describeOffset(offset time.Duration, ts *int64, startOrEnd parser.ItemType) string {
+	var s string
+	switch {
+	case ts != nil:
+		s += " at " + time.UnixMilli(*ts).UTC().Format(time.RFC3339)
+	case startOrEnd == parser.START:
+		s += " at the start of the queried range"
+	case startOrEnd == parser.END:
+		s += " at the end of the queried range"
+	}
+
+	switch {
+	case offset > 0:
+		s += fmt.Sprintf(", as of %s earlier", model.Duration(offset))
+	case offset < 0:
+		s += fmt.Sprintf(", as of %s later", model.Duration(-offset))
+	}
+
+	return s
+}
+
+// functions describes what functions compute from their first argument,
+// which the description refers to as %s.
+var functions = map[string]string{
+	"rate":                         "the per-second average rate of increase of each counter in %s, accounting for counter resets",
+	"irate":                        "the per-second rate of increase of each counter in %s from its last two samples",
+	"increase":                     "the total increase of each counter in %s over its range, accounting for counter resets",
+	"delta":                        "the difference between the first and last value of each gauge in %s",
+	"idelta":                       "the difference between the last two samples of each gauge in %s",
+	"deriv":                        "the per-second derivative of each gauge in %s using linear regression",
+	"changes":                      "the number of times the value of each series in %s changed",
+	"resets":                       "the number of counter resets of each series in %s",
+	"avg_over_time":                "the average of the samples of each series in %s",
+	"min_over_time":                "the minimum of the samples of each series in %s",
+	"max_over_time":                "the maximum of the samples of each series in %s",
+	"sum_over_time":                "the sum of the samples of each series in %s",
+	"count_over_time":              "the number of samples of each series in %s",
+	"stddev_over_time":             "the standard deviation of the samples of each series in %s",
+	"stdvar_over_time":             "the standard variance of the samples of each series in %s",
+	"mad_over_time":                "the median absolute deviation of the samples of each series in %s",
+	"last_over_time":               "the most recent sample of each series in %s",
+	"present_over_time":            "1 for each series in %s that has any samples",
+	"absent_over_time":             "1 if %s has no series with samples, and nothing otherwise",
+	"absent":                       "1 if %s has no series, and nothing otherwise",
+	"abs":                          "the absolute value of each value of %s",
+	"ceil":                         "each value of %s rounded up to an integer",
+	"floor":                        "each value of %s rounded down to an integer",
+	"sqrt":                         "the square root of each value of %s",
+	"exp":                          "the exponential of each value of %s",
+	"ln":                           "the natural logarithm of each value of %s",
+	"log2":                         "the base 2 logarithm of each value of %s",
+	"log10":                        "the base 10 logarithm of each value of %s",
+	"sgn":                          "the sign (-1, 0 or 1) of each value of %s",
+	"timestamp":                    "the timestamp, in seconds, of the sample of each series in %s",
+	"sort":                         "%s sorted by value, ascending",
+	"sort_desc":                    "%s sorted by value, descending",
+	"scalar":                       "the value of the only series in %s as a number, or NaN if it does not have exactly one",
+	"vector":                       "%s as a series without labels",
+	"histogram_count":              "the observation count of each native histogram in %s",
+	"histogram_sum":                "the sum of observations of each native histogram in %s",
+	"histogram_avg":                "the average observation of each native histogram in %s",
+	"histogram_stddev":             "the estimated standard deviation of observations of each native histogram in %s",
+	"histogram_stdvar":             "the estimated standard variance of observations of each native histogram in %s",
+	"day_of_week":                  "the day of the week (0 is Sunday) of each value of %s as a timestamp, in UTC",
+	"day_of_month":                 "the day of the month of each value of %s as a timestamp, in UTC",
+	"hour":                         "the hour of the day of each value of %s as a timestamp, in UTC",
+	"minute":                       "the minute of the hour of each value of %s as a timestamp, in UTC",
+	"month":                        "the month of each value of %s as a timestamp, in UTC",
+	"year":                         "the year of each value of %s as a timestamp, in UTC",
+	"days_in_month":                "the number of days in the month of each value of %s as a timestamp, in UTC",
+	"day_of_year":                  "the day of the year of each value of %s as a timestamp, in UTC",
+	"double_exponential_smoothing": "a smoothed value of each gauge in %s using double exponential smoothing",
+}
+
+// keepsName are the functions that return series with their metric name.
+var keepsName = []string{
+	"last_over_time", "sort", "sort_desc", "sort_by_label", "sort_by_label_desc",
+	"label_replace", "label_join", "info",
+}
+
+func (x *explainer) explainCall(e *parser.Call) operand {
+	args := make([]operand, 0, len(e.Args))
+	for _, a := range e.Args {
+		args = append(args, x.explain(a))
+	}
+	ref := func(i int) string {
+		if i < len(args) {
+			return args[i].ref
+		}
+		return "the time of evaluation"
+	}
+
+	// The labels of the first vector argument, or none.
+	var ls labelSet
+	hasVector := false
+	for i, a := range e.Args {
+		if t := a.Type(); t == parser.ValueTypeVector || t == parser.ValueTypeMatrix {
+			ls, hasVector = args[i].labels, true
+			break
+		}
+	}
+	if !hasVector {
+		ls = labelSet{known: true}
+	}
+	if !slices.Contains(keepsName, e.Func.Name) {
+		ls = ls.withoutName()
+	}
+
+	var desc string
+	switch e.Func.Name {
+	case "time":
+		desc = "the current evaluation time as seconds since the Unix epoch"
+	case "pi":
+		desc = "the number pi"
+	case "histogram_quantile":
+		desc = fmt.Sprintf("the %s quantile of the histograms in %s, from their le buckets", ref(0), ref(1))
+		ls = ls.without("le")
+	case "histogram_fraction":
+		desc = fmt.Sprintf("the fraction of observations between %s and %s in each histogram of %s", ref(0), ref(1), ref(2))
+	case "quantile_over_time":
+		desc = fmt.Sprintf("the %s quantile of the samples of each series in %s", ref(0), ref(1))
+	case "predict_linear":
+		desc = fmt.Sprintf("the value each gauge in %s is predicted to have %s seconds from now, using linear regression", ref(0), ref(1))
+	case "clamp":
+		desc = fmt.Sprintf("each value of %s limited to between %s and %s", ref(0), ref(1), ref(2))
+	case "clamp_min":
+		desc = fmt.Sprintf("each value of %s, but at least %s", ref(0), ref(1))
+	case "clamp_max":
+		desc = fmt.Sprintf("each value of %s, but at most %s", ref(0), ref(1))
+	case "round":
+		desc = fmt.Sprintf("each value of %s rounded to the nearest integer", ref(0))
+		if len(args) > 1 {
+			desc = fmt.Sprintf("each value of %s rounded to the nearest multiple of %s", ref(0), ref(1))
+		}
+	case "label_replace":
+		desc = fmt.Sprintf("%s with label %s set to %s wherever label %s fully matches the regex %s",
+			ref(0), unquote(ref(1)), ref(2), unquote(ref(3)), ref(4))
+		ls = ls.with(unquote(ref(1)))
+	case "label_join":
+		src := make([]string, 0, len(args))
+		for i := 3; i < len(args); i++ {
+			src = append(src, unquote(args[i].ref))
+		}
+		desc = fmt.Sprintf("%s with label %s set to the values of labels %s joined by %s",
+			ref(0), unquote(ref(1)), strings.Join(src, ", "), ref(2))
+		ls = ls.with(unquote(ref(1)))
+	case "sort_by_label", "sort_by_label_desc":
+		order := "ascending"
+		if e.Func.Name == "sort_by_label_desc" {
+			order = "descending"
+		}
+		by := make([]string, 0, len(args))
+		for i := 1; i < len(args); i++ {
+			by = append(by, unquote(args[i].ref))
+		}
+		desc = fmt.Sprintf("%s sorted by the labels %s, %s", ref(0), strings.Join(by, ", "), order)
+	case "absent", "absent_over_time":
+		desc = fmt.Sprintf(functions[e.Func.Name], ref(0))
+		ls = labelSet{known: true, labels: equalityLabels(e.Args[0])}
+	case "vector":
+		desc = fmt.Sprintf(functions[e.Func.Name], ref(0))
+		ls = labelSet{known: true}
+	default:
+		if f, ok := functions[e.Func.Name]; ok {
+			desc = fmt.Sprintf(f, ref(0))
+		} else {
+			refs := make([]string, 0, len(args))
+			for _, a := range args {
+				refs = append(refs, a.ref)
+			}
+			desc = fmt.Sprintf("%s(%s)", e.Func.Name, strings.Join(refs, ", "))
+		}
+	}
+
+	return operand{
+		ref:    x.step("Compute %s (%s).", desc, e.Func.Name),
+		labels: ls,
+	}
+}
+
+// equalityLabels returns the labels absent copies from the equality
+// matchers of the selector of expr.
+func equalityLabels(expr parser.Expr) []string {
+	var vs *parser.VectorSelector
+	switch e := expr.(type) {
+	case *parser.VectorSelector:
+		vs = e
+	case *parser.MatrixSelector:
+		vs = e.VectorSelector.(*parser.VectorSelector)
+	default:
+		return nil
+	}
+
+	var names []string
+	for _, m := range vs.LabelMatchers {
+		if m.Type == labels.MatchEqual && m.Name != labels.MetricName {
+			names = append(names, m.Name)
+		}
+	}
+	return names
+}
+
+// aggregations describes what aggregation operators compute over each
+// group.
+var aggregations = map[parser.ItemType]string{
+	parser.SUM:    "Sum the values",
+	parser.AVG:    "Average the values",
+	parser.MIN:    "Take the minimum value",
+	parser.MAX:    "Take the maximum value",
+	parser.COUNT:  "Count the series",
+	parser.GROUP:  "Return 1 for each group",
+	parser.STDDEV: "Compute the standard deviation of the values",
+	parser.STDVAR: "Compute the standard variance of the values",
+}
+
+func (x *explainer) explainAggregate(e *parser.AggregateExpr) operand {
+	inner := x.explain(e.Expr)
+
+	var param operand
+	if e.Param != nil {
+		param = x.explain(e.Param)
+	}
+
+	var (
+		grouping string
+		ls       labelSet
+	)
+	switch {
+	case e.Without:
+		grouping = "series with the same labels apart from " + joinAnd(e.Grouping) + " and the metric name"
+		ls = inner.labels.withoutName().without(e.Grouping...)
+	case len(e.Grouping) > 0:
+		grouping = "series with the same " + joinAnd(e.Grouping)
+		ls = inner.labels.only(e.Grouping...)
+	default:
+		grouping = "all series"
+		ls = labelSet{known: true}
+	}
+
+	var desc string
+	switch e.Op {
+	case parser.TOPK, parser.BOTTOMK:
+		which := "largest"
+		if e.Op == parser.BOTTOMK {
+			which = "smallest"
+		}
+		desc = fmt.Sprintf("Keep the %s series with the %s values of %s, among %s", param.ref, which, inner.ref, groupingScope(grouping))
+		ls = inner.labels
+	case parser.LIMITK:
+		desc = fmt.Sprintf("Keep any %s series of %s, among %s", param.ref, inner.ref, groupingScope(grouping))
+		ls = inner.labels
+	case parser.LIMIT_RATIO:
+		desc = fmt.Sprintf("Keep a %s share of the series of %s, among %s", param.ref, inner.ref, groupingScope(grouping))
+		ls = inner.labels
+	case parser.QUANTILE:
+		desc = fmt.Sprintf("Compute the %s quantile of the values of %s over %s", param.ref, inner.ref, grouping)
+	case parser.COUNT_VALUES:
+		desc = fmt.Sprintf("Count the series of %s with the same value over %s, storing the value in label %s", inner.ref, grouping, unquote(param.ref))
+		ls = ls.with(unquote(param.ref))
+	default:
+		desc = fmt.Sprintf("%s of %s over %s", aggregations[e.Op], inner.ref, grouping)
+	}
+
+	return operand{ref: x.step("%s (%s).", desc, e.Op), labels: ls}
+}
+
+func groupingScope(grouping string) string {
+	if grouping == "all series" {
+		return grouping
+	}
+	return "each group of " + grouping
+}
+
+// binaryOps describes arithmetic binary operators as a verb and a
+// preposition. Sentences for addition and subtraction name the right-hand
+// operand first, as in "Subtract b from a".
+var binaryOps = map[parser.ItemType]struct {
+	verb, prep string
+}{
+	parser.ADD:   {"Add", "to"},
+	parser.SUB:   {"Subtract", "from"},
+	parser.MUL:   {"Multiply", "by"},
+	parser.DIV:   {"Divide", "by"},
+	parser.MOD:   {"Take the remainder of dividing", "by"},
+	parser.POW:   {"Raise", "to the power of"},
+	parser.ATAN2: {"Compute the arc tangent of", "over"},
+}
+
+// flippedComparisons are the operators comparing the operands the other way
+// round, for describing the right-hand side of a comparison.
+var flippedComparisons = map[parser.ItemType]parser.ItemType{
+	parser.GTR: parser.LSS,
+	parser.LSS: parser.GTR,
+	parser.GTE: parser.LTE,
+	parser.LTE: parser.GTE,
+}
+
+var comparisons = map[parser.ItemType]string{
+	parser.EQLC: "equal to",
+	parser.NEQ:  "not equal to",
+	parser.GTR:  "greater than",
+	parser.LSS:  "less than",
+	parser.GTE:  "greater than or equal to",
+	parser.LTE:  "less than or equal to",
+}
+
+func (x *explainer) explainBinary(e *parser.BinaryExpr) operand {
+	lhs := x.explain(e.LHS)
+	rhs := x.explain(e.RHS)
+
+	lvec := e.LHS.Type() == parser.ValueTypeVector
+	rvec := e.RHS.Type() == parser.ValueTypeVector
+
+	var (
+		desc string
+		ls   labelSet
+	)
+
+	switch {
+	case e.Op.IsSetOperator():
+		match := describeMatching(e.VectorMatching, false)
+		switch e.Op {
+		case parser.LAND:
+			desc = fmt.Sprintf("Keep the series of %s that have a matching series in %s (%s)", lhs.ref, rhs.ref, match)
+			ls = lhs.labels
+		case parser.LOR:
+			desc = fmt.Sprintf("Take all series of %s, plus the series of %s that have no matching series in it (%s)", lhs.ref, rhs.ref, match)
+			ls = lhs.labels.union(rhs.labels)
+		case parser.LUNLESS:
+			desc = fmt.Sprintf("Keep the series of %s that have no matching series in %s (%s)", lhs.ref, rhs.ref, match)
+			ls = lhs.labels
+		}
+
+	case e.Op.IsComparisonOperator():
+		cmp := comparisons[e.Op]
+		switch {
+		case !lvec && !rvec:
+			desc = fmt.Sprintf("Return 1 if %s is %s %s, and 0 otherwise", lhs.ref, cmp, rhs.ref)
+		case e.ReturnBool:
+			desc = fmt.Sprintf("Return 1 where %s is %s %s, and 0 otherwise", lhs.ref, cmp, rhs.ref)
+		case lvec:
+			desc = fmt.Sprintf("Keep only the series of %s whose value is %s %s", lhs.ref, cmp, rhs.ref)
+		default:
+			if op, ok := flippedComparisons[e.Op]; ok {
+				cmp = comparisons[op]
+			}
+			desc = fmt.Sprintf("Keep only the series of %s whose value is %s %s", rhs.ref, cmp, lhs.ref)
+		}
+		if lvec && rvec {
+			desc += " (" + describeMatching(e.VectorMatching, true) + ")"
+		}
+
+		switch {
+		case !lvec && !rvec:
+			ls = labelSet{known: true}
+		case !e.ReturnBool && lvec:
+			ls = lhs.labels
+			if rvec {
+				ls = matchedLabels(e.VectorMatching, lhs.labels, rhs.labels, e.ReturnBool)
+			}
+		case !e.ReturnBool:
+			ls = rhs.labels
+		default:
+			ls = matchedLabels(e.VectorMatching, lhs.labels, rhs.labels, true)
+		}
+
+	default:
+		op := binaryOps[e.Op]
+		switch e.Op {
+		case parser.ADD, parser.SUB:
+			desc = fmt.Sprintf("%s %s %s %s", op.verb, rhs.ref, op.prep, lhs.ref)
+		default:
+			desc = fmt.Sprintf("%s %s %s %s", op.verb, lhs.ref, op.prep, rhs.ref)
+		}
+		if lvec && rvec {
+			desc += " (" + describeMatching(e.VectorMatching, true) + ")"
+		}
+		ls = matchedLabels(e.VectorMatching, lhs.labels, rhs.labels, true)
+		if !lvec || !rvec {
+			ls = lhs.labels
+			if !lvec {
+				ls = rhs.labels
+			}
+			if !lvec && !rvec {
+				ls = labelSet{known: true}
+			}
+			ls = ls.withoutName()
+		}
+	}
+
+	return operand{ref: x.step("%s.", desc), labels: ls}
+}
+
+// describeMatching describes how the series of both sides of a binary
+// operation are matched.
+func describeMatching(vm *parser.VectorMatching, cardinality bool) string {
+	var match string
+	switch {
+	case vm == nil:
+		match = "matching series with identical labels"
+	case vm.On:
+		match = "matching series on " + joinAnd(vm.MatchingLabels)
+		if len(vm.MatchingLabels) == 0 {
+			match = "matching every series with every other"
+		}
+	case len(vm.MatchingLabels) > 0:
+		match = "matching series with identical labels apart from " + joinAnd(vm.MatchingLabels)
+	default:
+		match = "matching series with identical labels apart from the metric name"
+	}
+
+	if !cardinality || vm == nil {
+		return match
+	}
+
+	switch vm.Card {
+	case parser.CardManyToOne:
+		match += "; many series on the left can match one on the right"
+		if len(vm.Include) > 0 {
+			match += ", whose " + joinAnd(vm.Include) + " are copied to the result"
+		}
+	case parser.CardOneToMany:
+		match += "; many series on the right can match one on the left"
+		if len(vm.Include) > 0 {
+			match += ", whose " + joinAnd(vm.Include) + " are copied to the result"
+		}
+	default:
+		match += "; each series must match at most one on the other side"
+	}
+
+	return match
+}
+
+// matchedLabels returns the labels of the result of a binary operation
+// between two vectors.
+func matchedLabels(vm *parser.VectorMatching, lhs, rhs labelSet, changesValue bool) labelSet {
+	if vm == nil {
+		return lhs.withoutName()
+	}
+
+	ls := lhs
+	if vm.Card == parser.CardOneToMany {
+		ls = rhs
+	}
+	if changesValue {
+		ls = ls.withoutName()
+	}
+
+	switch vm.Card {
+	case parser.CardOneToOne:
+		if vm.On {
+			return ls.only(vm.MatchingLabels...)
+		}
+		return ls.without(vm.MatchingLabels...)
+	default:
+		return ls.with(vm.Include...)
+	}
+}
+
+// labelSet describes the labels of the series of a result.
+type labelSet struct {
+	// known is set if the labels are exactly labels. Otherwise they are
+	// those of the selected series without dropped and with added.
+	known   bool
+	labels  []string
+	dropped []string
+	added   []string
+}
+
+func (l labelSet) withoutName() labelSet {
+	return l.without(labels.MetricName)
+}
+
+func (l labelSet) without(names ...string) labelSet {
+	if l.known {
+		l.labels = slices.DeleteFunc(slices.Clone(l.labels), func(n string) bool { return slices.Contains(names, n) })
+		return l
+	}
+	l.added = slices.DeleteFunc(slices.Clone(l.added), func(n string) bool { return slices.Contains(names, n) })
+	l.dropped = appendNew(slices.Clone(l.dropped), names...)
+	return l
+}
+
+func (l labelSet) with(names ...string) labelSet {
+	if l.known {
+		l.labels = appendNew(slices.Clone(l.labels), names...)
+		return l
+	}
+	l.dropped = slices.DeleteFunc(slices.Clone(l.dropped), func(n string) bool { return slices.Contains(names, n) })
+	l.added = appendNew(slices.Clone(l.added), names...)
+	return l
+}
+
+// only returns the labels of names that l may have.
+func (l labelSet) only(names ...string) labelSet {
+	var kept []string
+	for _, n := range names {
+		switch {
+		case l.known && !slices.Contains(l.labels, n):
+		case !l.known && slices.Contains(l.dropped, n):
+		default:
+			kept = append(kept, n)
+		}
+	}
+	return labelSet{known: true, labels: kept}
+}
+
+func (l labelSet) union(o labelSet) labelSet {
+	if l.known && o.known {
+		return labelSet{known: true, labels: appendNew(slices.Clone(l.labels), o.labels...)}
+	}
+	return labelSet{}
+}
+
+func (l labelSet) String() string {
+	if l.known {
+		if len(l.labels) == 0 {
+			return "without labels"
+		}
+		return "with only the labels " + joinAnd(l.labels)
+	}
+
+	s := "with the labels of the selected series"
+	var dropped []string
+	for _, n := range l.dropped {
+		if n == labels.MetricName {
+			dropped = append(dropped, "the metric name")
+		} else {
+			dropped = append(dropped, n)
+		}
+	}
+	if len(dropped) > 0 {
+		s += " except " + joinAnd(dropped)
+	}
+	if len(l.added) > 0 {
+		s += ", plus " + joinAnd(l.added)
+	}
+	return s
+}
+
+func appendNew(s []string, names ...string) []string {
+	for _, n := range names {
+		if !slices.Contains(s, n) {
+			s = append(s, n)
+		}
+	}
+	return s
+}
+
+// joinAnd joins s as an English list, e.g. "a, b and c".
+func joinAnd(s []string) string {
+	switch len(s) {
+	case 0:
+		return ""
+	case 1:
+		return s[0]
+	}
+	return strings.Join(s[:len(s)-1], ", ") + " and " + s[len(s)-1]
+}
+
+func unquote(s string) string {
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return s
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+func TestExplain(t *testing.T) {
+	const selectFoo = "Select the series of metric foo, taking the latest sample of each series from the last 5m."
+
+	tests := []struct {
+		expr       string
+		wantSteps  []string
+		wantResult string
+	}{
+		{
+			expr:       `foo{job="a"} offset 1h`,
+			wantSteps:  []string{`Select the series of metric foo where label job is "a", taking the latest sample of each series from the last 5m, as of 1h earlier.`},
+			wantResult: "an instant vector: one value per series, with the labels of the selected series",
+		},
+		{
+			expr: "foo < 5",
+			wantSteps: []string{
+				selectFoo,
+				"Keep only the series of the result of step 1 whose value is less than 5.",
+			},
+			wantResult: "an instant vector: one value per series, with the labels of the selected series",
+		},
+		{
+			expr: "5 < foo",
+			wantSteps: []string{
+				selectFoo,
+				"Keep only the series of the result of step 1 whose value is greater than 5.",
+			},
+			wantResult: "an instant vector: one value per series, with the labels of the selected series",
+		},
+		{
+			expr: "5 >= foo",
+			wantSteps: []string{
+				selectFoo,
+				"Keep only the series of the result of step 1 whose value is less than or equal to 5.",
+			},
+			wantResult: "an instant vector: one value per series, with the labels of the selected series",
+		},
+		{
+			expr: "5 != foo",
+			wantSteps: []string{
+				selectFoo,
+				"Keep only the series of the result of step 1 whose value is not equal to 5.",
+			},
+			wantResult: "an instant vector: one value per series, with the labels of the selected series",
+		},
+		{
+			expr: "5 < bool foo",
+			wantSteps: []string{
+				selectFoo,
+				"Return 1 where 5 is less than the result of step 1, and 0 otherwise.",
+			},
+			wantResult: "an instant vector: one value per series, with the labels of the selected series except the metric name",
+		},
+		{
+			expr:       "1 > bool 2",
+			wantSteps:  []string{"Return 1 if 1 is greater than 2, and 0 otherwise."},
+			wantResult: "a single number without labels",
+		},
+		{
+			expr: "sum by (job) (rate(x[5m])) > 0",
+			wantSteps: []string{
+				"Select the series of metric x, taking every sample of each series from the last 5m.",
+				"Compute the per-second average rate of increase of each counter in the result of step 1, accounting for counter resets (rate).",
+				"Sum the values of the result of step 2 over series with the same job (sum).",
+				"Keep only the series of the result of step 3 whose value is greater than 0.",
+			},
+			wantResult: "an instant vector: one value per series, with only the labels job",
+		},
+		{
+			expr: "a - b",
+			wantSteps: []string{
+				"Select the series of metric a, taking the latest sample of each series from the last 5m.",
+				"Select the series of metric b, taking the latest sample of each series from the last 5m.",
+				"Subtract the result of step 2 from the result of step 1 (matching series with identical labels apart from the metric name; each series must match at most one on the other side).",
+			},
+			wantResult: "an instant vector: one value per series, with the labels of the selected series except the metric name",
+		},
+		{
+			expr: "foo > on(job) bar",
+			wantSteps: []string{
+				selectFoo,
+				"Select the series of metric bar, taking the latest sample of each series from the last 5m.",
+				"Keep only the series of the result of step 1 whose value is greater than the result of step 2 (matching series on job; each series must match at most one on the other side).",
+			},
+			wantResult: "an instant vector: one value per series, with only the labels job",
+		},
+		{
+			expr: "foo > ignoring(instance) bar",
+			wantSteps: []string{
+				selectFoo,
+				"Select the series of metric bar, taking the latest sample of each series from the last 5m.",
+				"Keep only the series of the result of step 1 whose value is greater than the result of step 2 (matching series with identical labels apart from instance; each series must match at most one on the other side).",
+			},
+			wantResult: "an instant vector: one value per series, with the labels of the selected series except instance",
+		},
+		{
+			expr: "foo and on(job) bar",
+			wantSteps: []string{
+				selectFoo,
+				"Select the series of metric bar, taking the latest sample of each series from the last 5m.",
+				"Keep the series of the result of step 1 that have a matching series in the result of step 2 (matching series on job).",
+			},
+			wantResult: "an instant vector: one value per series, with the labels of the selected series",
+		},
+		{
+			expr: "topk(3, foo)",
+			wantSteps: []string{
+				selectFoo,
+				"Keep the 3 series with the largest values of the result of step 1, among all series (topk).",
+			},
+			wantResult: "an instant vector: one value per series, with the labels of the selected series",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+
+			got := explain(expr)
+			if diff := cmp.Diff(tt.wantSteps, got.steps); diff != "" {
+				t.Errorf("steps mismatch (-want +got):\n%s", diff)
+			}
+			if got.result != tt.wantResult {
+				t.Errorf("result = %q, want %q", got.result, tt.wantResult)
+			}
+		})
+	}
+}
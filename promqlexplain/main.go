@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+func main() {
+	if err := realMain(
+		context.Background(),
+		os.Stdin,
+		os.Stdout,
+		os.Args,
+	); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func realMain(
+	_ context.Context,
+	stdin io.Reader,
+	stdout io.Writer,
+	args []string,
+) error {
+	fs := flag.NewFlagSet("promqlexplain", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [expression]\n", args[0])
+		fmt.Fprintf(fs.Output(), "The expression is read from stdin if not given.\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	query := strings.Join(fs.Args(), " ")
+	if fs.NArg() == 0 {
+		b, err := io.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		query = string(b)
+	}
+
+	if strings.TrimSpace(query) == "" {
+		fs.Usage()
+		return fmt.Errorf("expected an expression")
+	}
+
+	expr, err := parser.ParseExpr(query)
+	if err != nil {
+		return fmt.Errorf("parse-expr: %w", err)
+	}
+
+	x := explain(expr)
+	for i, step := range x.steps {
+		fmt.Fprintf(stdout, "%d. %s\n", i+1, step)
+	}
+	fmt.Fprintf(stdout, "Result: %s.\n", x.result)
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// formatDashboard formats the expr of every query target in a Grafana
+// dashboard, i.e. the "expr" string of objects in any "targets" array.
+// The JSON is edited in place, so key order and layout are kept.
+func formatDashboard(src []byte, st style) ([]byte, error) {
+	lines := newLineIndex(src)
+
+	type frame struct {
+		object    bool
+		key       string // key this container is the value of
+		nextIsKey bool
+		lastKey   string
+	}
+
+	var (
+		stack []*frame
+		edits []edit
+	)
+
+	dec := json.NewDecoder(bytes.NewReader(src))
+	dec.UseNumber()
+
+	for {
+		before := dec.InputOffset()
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var parent *frame
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1]
+		}
+
+		if parent != nil && parent.object && parent.nextIsKey {
+			if d, ok := tok.(json.Delim); ok && d == '}' {
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			parent.lastKey = tok.(string)
+			parent.nextIsKey = false
+			continue
+		}
+
+		var key string
+		if parent != nil && parent.object {
+			key = parent.lastKey
+			parent.nextIsKey = true
+		}
+
+		switch tok := tok.(type) {
+		case json.Delim:
+			switch tok {
+			case '{', '[':
+				stack = append(stack, &frame{object: tok == '{', key: key, nextIsKey: tok == '{'})
+			case ']':
+				stack = stack[:len(stack)-1]
+			}
+		case string:
+			if key != "expr" || len(stack) < 2 || stack[len(stack)-2].key != "targets" || tok == "" {
+				continue
+			}
+
+			start := valueStart(src, before)
+			formatted, err := st.format(tok)
+			if err != nil {
+				// The decoded expression is what the parser saw, so map its
+				// offsets back through the escapes of the JSON string.
+				line := lines.line(start)
+				column := start - lines[line-1] + 2
+				raw := src[start+1 : dec.InputOffset()]
+				return nil, &exprError{
+					line:   line,
+					column: column,
+					err:    err,
+					columnOf: func(offset int) int {
+						return column + escapedOffset(raw, offset)
+					},
+				}
+			}
+			if formatted == tok {
+				continue
+			}
+
+			text, err := marshalString(formatted)
+			if err != nil {
+				return nil, err
+			}
+			edits = append(edits, edit{start: start, end: int(dec.InputOffset()), text: text})
+		}
+	}
+
+	if len(stack) != 0 {
+		return nil, fmt.Errorf("unexpected end of JSON input")
+	}
+
+	return applyEdits(src, edits), nil
+}
+
+// marshalString quotes s as a JSON string without escaping <, > and &,
+// which are common in PromQL and which json.Marshal escapes for HTML.
+func marshalString(s string) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))), nil
+}
+
+// escapedOffset returns the offset in the JSON string literal raw, without
+// its opening quote, of the byte at offset of the decoded string.
+func escapedOffset(raw []byte, offset int) int {
+	r := 0
+	for d := 0; d < offset && r < len(raw); {
+		if raw[r] != '\\' || r+1 >= len(raw) {
+			r++
+			d++
+			continue
+		}
+		if raw[r+1] != 'u' {
+			r += 2
+			d++
+			continue
+		}
+
+		// \uXXXX decodes to the UTF-8 encoding of the code unit, or of
+		// the code point of a surrogate pair spelled as two escapes.
+		r1 := hexRune(raw[r+2:])
+		if utf16.IsSurrogate(r1) {
+			if r+12 <= len(raw) && raw[r+6] == '\\' && raw[r+7] == 'u' &&
+				utf16.DecodeRune(r1, hexRune(raw[r+8:])) != utf8.RuneError {
+				r += 12
+				d += 4
+				continue
+			}
+			r1 = utf8.RuneError
+		}
+		r += 6
+		d += max(utf8.RuneLen(r1), 1)
+	}
+	return min(r, len(raw))
+}
+
+// hexRune parses the four hex digits b starts with, returning -1 if it
+// does not.
+func hexRune(b []byte) rune {
+	if len(b) < 4 {
+		return -1
+	}
+	n, err := strconv.ParseUint(string(b[:4]), 16, 16)
+	if err != nil {
+		return -1
+	}
+	return rune(n)
+}
+
+// valueStart skips the whitespace and separators the decoder has not
+// consumed yet before the token at offset.
+func valueStart(src []byte, offset int64) int {
+	i := int(offset)
+	for i < len(src) {
+		switch src[i] {
+		case ' ', '\t', '\r', '\n', ':', ',':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// line returns the 1-based line of offset.
+func (idx lineIndex) line(offset int) int {
+	lo, hi := 0, len(idx)
+	for lo+1 < hi {
+		mid := (lo + hi) / 2
+		if idx[mid] <= offset {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo + 1
+}
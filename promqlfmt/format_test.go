@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFormatRules(t *testing.T) {
+	tests := []struct {
+		name string
+		st   style
+		src  string
+		want string
+	}{
+		{
+			name: "plain scalar",
+			src: `groups:
+  - name: example
+    rules:
+      - alert: HighErrors
+        expr: sum by(job)(rate(errors_total[5m]))>0
+        for: 5m
+`,
+			want: `groups:
+  - name: example
+    rules:
+      - alert: HighErrors
+        expr: sum by (job) (rate(errors_total[5m])) > 0
+        for: 5m
+`,
+		},
+		{
+			name: "quoted scalars keep their quotes",
+			src: `groups:
+- name: a
+  rules:
+  - alert: A
+    expr: "up<1"
+  - alert: B
+    expr: 'up  ==  0'
+`,
+			want: `groups:
+- name: a
+  rules:
+  - alert: A
+    expr: "up < 1"
+  - alert: B
+    expr: 'up == 0'
+`,
+		},
+		{
+			name: "formatted block scalar is kept",
+			src: `groups:
+  - name: example
+    rules:
+      - record: job:up:sum
+        expr: |
+          sum by (job) (up)
+`,
+			want: `groups:
+  - name: example
+    rules:
+      - record: job:up:sum
+        expr: |
+          sum by (job) (up)
+`,
+		},
+		{
+			name: "split over lines",
+			st:   style{width: 30},
+			src: `groups:
+  - name: example
+    rules:
+      - alert: HighErrors
+        expr: sum by (job) (rate(errors_total[5m])) > 0
+        for: 5m
+`,
+			want: `groups:
+  - name: example
+    rules:
+      - alert: HighErrors
+        expr: |2
+            sum by (job) (
+              rate(errors_total[5m])
+            )
+          >
+            0
+        for: 5m
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := formatRules([]byte(tt.src), tt.st)
+			if err != nil {
+				t.Fatalf("format: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, string(got)); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFormatDashboard(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "targets only",
+			src: `{
+  "panels": [
+    {
+      "targets": [
+        {"expr": "sum(rate(errors_total{code=~\"5..\"}[5m]))>0", "refId": "A"},
+        {"expr": "up", "refId": "B"}
+      ],
+      "expr": "not_a_target( )"
+    }
+  ]
+}
+`,
+			want: `{
+  "panels": [
+    {
+      "targets": [
+        {"expr": "sum(rate(errors_total{code=~\"5..\"}[5m])) > 0", "refId": "A"},
+        {"expr": "up", "refId": "B"}
+      ],
+      "expr": "not_a_target( )"
+    }
+  ]
+}
+`,
+		},
+		{
+			name: "comparison operators are not HTML-escaped",
+			src:  `{"targets": [{"expr": "up<1 and on(job)foo>2"}]}`,
+			want: `{"targets": [{"expr": "up < 1 and on (job) foo > 2"}]}`,
+		},
+		{
+			name: "empty expr",
+			src:  `{"targets": [{"expr": ""}]}`,
+			want: `{"targets": [{"expr": ""}]}`,
+		},
+		{
+			name:    "parse error position",
+			src:     `{"targets": [{"expr": "up("}]}`,
+			wantErr: "d.json:1:27: parse error: unclosed left parenthesis",
+		},
+		{
+			name:    "parse error position after escapes",
+			src:     `{"targets": [{"expr": "up{job=\"a\"}\n+ }"}]}`,
+			wantErr: "d.json:1:41: parse error: unexpected character: '}'",
+		},
+		{
+			name:    "parse error position after unicode escapes",
+			src:     `{"targets": [{"expr": "label_join(up, \"d\u00e9\", \"\ud83d\ude00\", \"a\") + }"}]}`,
+			wantErr: "d.json:1:79: parse error: unexpected character: '}'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := formatDashboard([]byte(tt.src), style{})
+			if tt.wantErr != "" {
+				var perr *exprError
+				if !errors.As(err, &perr) {
+					t.Fatalf("format: got error %v, want %s", err, tt.wantErr)
+				}
+				if got := positionError("d.json", perr).Error(); got != tt.wantErr {
+					t.Errorf("error = %q, want %q", got, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("format: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, string(got)); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
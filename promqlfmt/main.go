@@ -1,11 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/prometheus/prometheus/promql/parser"
 )
@@ -26,24 +33,269 @@ func main() {
 	}
 }
 
+var (
+	errUnformatted = errors.New("some files are not formatted")
+	errFailed      = errors.New("some files could not be formatted")
+)
+
 func realmain(
 	_ context.Context,
 	stdin io.Reader,
 	stdout io.Writer,
-	_ io.Writer,
-	_ []string,
+	stderr io.Writer,
+	args []string,
 ) error {
-	b, err := io.ReadAll(stdin)
+	fs := flag.NewFlagSet("promqlfmt", flag.ExitOnError)
+	fs.SetOutput(stderr)
+	flagWrite := fs.Bool("w", false, "write result to (source) file instead of stdout")
+	flagDiff := fs.Bool("d", false, "display diffs instead of rewriting files")
+	flagList := fs.Bool("l", false, "list files whose formatting differs from promqlfmt's")
+	flagCheck := fs.Bool("check", false, "exit non-zero if any file is not formatted")
+	flagWidth := fs.Int("width", 0, "maximum line width, including indentation (default 100)")
+	flagIndent := fs.String("indent", "", "indentation per level: a number of spaces, or \"tab\" (default 2)")
+	flagGrouping := fs.String("grouping", "", "place by/without clauses before or after the aggregated expression: before|after (default before)")
+	flagMinify := fs.Bool("minify", false, "print every expression on a single line")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: promqlfmt [flags] [path ...]\n\n")
+		fmt.Fprintf(stderr, "Formats a PromQL expression from stdin, or the files given. Files\n")
+		fmt.Fprintf(stderr, "can be PromQL (.promql), Prometheus rule files (.yml, .yaml) or\n")
+		fmt.Fprintf(stderr, "Grafana dashboards (.json); directories are walked for all three.\n\n")
+		fmt.Fprintf(stderr, "Without any of -width, -indent, -grouping or -minify, expressions are\n")
+		fmt.Fprintf(stderr, "printed exactly as Prometheus' own pretty printer does.\n\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	st := style{width: *flagWidth, minify: *flagMinify}
+
+	var err error
+	if *flagIndent != "" {
+		if st.indent, err = parseIndent(*flagIndent); err != nil {
+			return err
+		}
+		st.indentSet = true
+	}
+
+	if st.groupingAfter, err = parseGrouping(*flagGrouping); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		b, err := io.ReadAll(stdin)
+		if err != nil {
+			return fmt.Errorf("read: %w", err)
+		}
+
+		res, err := st.format(string(b))
+		if err != nil {
+			return positionError("<stdin>", &exprError{line: 1, column: 1, err: err})
+		}
+
+		_, _ = fmt.Fprintf(stdout, "%s\n", res)
+
+		return nil
+	}
+
+	var paths []string
+	for _, arg := range fs.Args() {
+		p, err := expandPath(arg)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, p...)
+	}
+
+	var unformatted, failed bool
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		res, err := formatFile(path, src, st)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			failed = true
+			continue
+		}
+
+		if bytes.Equal(src, res) {
+			if !*flagWrite && !*flagDiff && !*flagList && !*flagCheck {
+				_, _ = stdout.Write(res)
+			}
+			continue
+		}
+		unformatted = true
+
+		if *flagList {
+			fmt.Fprintln(stdout, path)
+		}
+
+		if *flagDiff {
+			_, _ = io.WriteString(stdout, unifiedDiff(path, string(src), string(res)))
+		}
+
+		if *flagWrite {
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(path, res, info.Mode().Perm()); err != nil {
+				return err
+			}
+		}
+
+		if *flagCheck && !*flagDiff && !*flagList {
+			fmt.Fprintf(stderr, "%s: not formatted\n", path)
+		}
+
+		if !*flagWrite && !*flagDiff && !*flagList && !*flagCheck {
+			_, _ = stdout.Write(res)
+		}
+	}
+
+	if failed {
+		return errFailed
+	}
+
+	if *flagCheck && unformatted {
+		return errUnformatted
+	}
+
+	return nil
+}
+
+// expandPath returns path, or the supported files under it if it is a
+// directory. Hidden directories are skipped.
+func expandPath(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var paths []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != path && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch filepath.Ext(p) {
+		case ".promql", ".yml", ".yaml", ".json":
+			paths = append(paths, p)
+		}
+		return nil
+	})
+
+	return paths, err
+}
+
+// formatFile formats every PromQL expression in src, picking the file
+// format from the extension of path.
+func formatFile(path string, src []byte, st style) ([]byte, error) {
+	var (
+		res []byte
+		err error
+	)
+
+	switch filepath.Ext(path) {
+	case ".promql":
+		res, err = formatPromQL(src, st)
+	case ".yml", ".yaml":
+		res, err = formatRules(src, st)
+	case ".json":
+		res, err = formatDashboard(src, st)
+	default:
+		return nil, fmt.Errorf("%s: unsupported file type", path)
+	}
+
+	var exprErr *exprError
+	if errors.As(err, &exprErr) {
+		return nil, positionError(path, exprErr)
+	}
 	if err != nil {
-		return fmt.Errorf("read: %w", err)
+		return nil, fmt.Errorf("%s: %w", path, err)
 	}
 
-	expr, err := parser.ParseExpr(string(b))
+	return res, nil
+}
+
+// formatPromQL formats a file holding a single PromQL expression.
+func formatPromQL(src []byte, st style) ([]byte, error) {
+	res, err := st.format(string(src))
 	if err != nil {
-		return fmt.Errorf("parse: %w", err)
+		return nil, &exprError{line: 1, column: 1, err: err}
 	}
 
-	_, _ = fmt.Fprintf(stdout, "%s\n", expr.Pretty(0))
+	return []byte(res + "\n"), nil
+}
+
+// exprError is an expression embedded in a file that failed to parse.
+type exprError struct {
+	// line and column are where the expression starts in the file.
+	line, column int
+	// indent is the indentation of the lines of the expression after the
+	// first, as in YAML block scalars.
+	indent int
+	// columnOf, if set, returns the column in the file of a byte offset
+	// of the expression, for expressions escaped on a single line.
+	columnOf func(offset int) int
+	err      error
+}
+
+func (e *exprError) Error() string {
+	return fmt.Sprintf("%d:%d: %v", e.line, e.column, e.err)
+}
+
+// positionError returns the error of e as "path:line:col: parse error: msg",
+// with the position in the file of where the parser failed.
+func positionError(path string, e *exprError) error {
+	var perrs parser.ParseErrors
+	if !errors.As(e.err, &perrs) || len(perrs) == 0 {
+		return fmt.Errorf("%s:%d:%d: parse: %w", path, e.line, e.column, e.err)
+	}
+
+	perr := perrs[0]
+	line, column := e.line, e.column
+
+	// Count lines and columns in bytes up to the start of the error, the
+	// same as the parser does.
+	query := perr.Query
+	pos := min(int(perr.PositionRange.Start), len(query))
+	switch i := strings.LastIndexByte(query[:pos], '\n'); {
+	case e.columnOf != nil:
+		column = e.columnOf(pos)
+	case i >= 0:
+		line += strings.Count(query[:pos], "\n")
+		column = e.indent + pos - i
+	default:
+		column += pos
+	}
+
+	return fmt.Errorf("%s:%d:%d: parse error: %w", path, line, column, perr.Err)
+}
+
+// parseIndent parses the value of the -indent flag. 0 disables
+// indentation.
+func parseIndent(v string) (string, error) {
+	if v == "tab" {
+		return "\t", nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("invalid indent %q (expected: a number of spaces or \"tab\")", v)
+	}
 
-	return err
+	return strings.Repeat(" ", n), nil
 }
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// style configures how expressions are printed. The zero style prints
+// with parser.Expr.Pretty.
+type style struct {
+	// width is the line width, counting indentation, an expression is
+	// split over several lines at.
+	width int
+	// indent is the string each nesting level is indented with, if
+	// indentSet. It may be empty to not indent at all.
+	indent    string
+	indentSet bool
+	// groupingAfter prints by and without clauses after the aggregated
+	// expression instead of before it.
+	groupingAfter bool
+	// minify prints every expression on one line with as little
+	// whitespace as possible.
+	minify bool
+}
+
+const (
+	defaultWidth  = 100
+	defaultIndent = "  "
+)
+
+// format parses expr and returns it printed in style s.
+func (s style) format(expr string) (string, error) {
+	e, err := parser.ParseExpr(expr)
+	if err != nil {
+		return "", err
+	}
+
+	if s == (style{}) {
+		return e.Pretty(0), nil
+	}
+
+	if s.width <= 0 {
+		s.width = defaultWidth
+	}
+	if !s.indentSet {
+		s.indent = defaultIndent
+	}
+
+	if s.minify {
+		return s.flat(e), nil
+	}
+
+	return s.pretty(e, 0), nil
+}
+
+// flat returns e on a single line.
+func (s style) flat(e parser.Expr) string {
+	sep := ", "
+	if s.minify {
+		sep = ","
+	}
+
+	switch e := e.(type) {
+	case *parser.AggregateExpr:
+		args := s.flat(e.Expr)
+		if e.Param != nil {
+			args = s.flat(e.Param) + sep + args
+		}
+		return s.aggregate(e, "("+args+")")
+
+	case *parser.BinaryExpr:
+		return s.flat(e.LHS) + " " + e.ShortString() + " " + s.flat(e.RHS)
+
+	case *parser.Call:
+		args := make([]string, 0, len(e.Args))
+		for _, a := range e.Args {
+			args = append(args, s.flat(a))
+		}
+		return e.Func.Name + "(" + strings.Join(args, sep) + ")"
+
+	case *parser.ParenExpr:
+		return "(" + s.flat(e.Expr) + ")"
+
+	case *parser.UnaryExpr:
+		return e.Op.String() + s.flat(e.Expr)
+
+	case *parser.SubqueryExpr:
+		return s.flat(e.Expr) + subquerySuffix(e)
+
+	default:
+		return e.String()
+	}
+}
+
+// pretty returns e indented to level, split over several lines where it
+// does not fit in the line width.
+func (s style) pretty(e parser.Expr, level int) string {
+	ind := strings.Repeat(s.indent, level)
+
+	if flat := s.flat(e); len(ind)+len(flat) <= s.width {
+		return ind + flat
+	}
+
+	switch e := e.(type) {
+	case *parser.AggregateExpr:
+		var args []parser.Expr
+		if e.Param != nil {
+			args = append(args, e.Param)
+		}
+		args = append(args, e.Expr)
+		return ind + s.aggregate(e, s.block("(", args, ")", level))
+
+	case *parser.BinaryExpr:
+		return s.pretty(e.LHS, level+1) + "\n" +
+			ind + e.ShortString() + "\n" +
+			s.pretty(e.RHS, level+1)
+
+	case *parser.Call:
+		return ind + e.Func.Name + s.block("(", e.Args, ")", level)
+
+	case *parser.ParenExpr:
+		return ind + s.block("(", parser.Expressions{e.Expr}, ")", level)
+
+	case *parser.UnaryExpr:
+		return ind + e.Op.String() + strings.TrimPrefix(s.pretty(e.Expr, level), ind)
+
+	case *parser.SubqueryExpr:
+		return s.pretty(e.Expr, level) + subquerySuffix(e)
+
+	default:
+		return ind + e.String()
+	}
+}
+
+// block returns args one per line between open and close, with close on
+// its own line at level.
+func (s style) block(open string, args parser.Expressions, close string, level int) string {
+	lines := make([]string, 0, len(args))
+	for _, a := range args {
+		lines = append(lines, s.pretty(a, level+1))
+	}
+
+	return open + "\n" + strings.Join(lines, ",\n") + "\n" + strings.Repeat(s.indent, level) + close
+}
+
+// aggregate returns the aggregation operator of e applied to args, with
+// its grouping placed as configured.
+func (s style) aggregate(e *parser.AggregateExpr, args string) string {
+	op := e.Op.String()
+	grouping := strings.TrimSpace(strings.TrimPrefix(e.ShortString(), op))
+	if grouping == "" {
+		return op + args
+	}
+
+	if s.groupingAfter {
+		return op + args + " " + grouping
+	}
+	if s.minify {
+		return op + " " + grouping + args
+	}
+	return op + " " + grouping + " " + args
+}
+
+// subquerySuffix returns the range, step, @ and offset of e as printed
+// after its expression.
+func subquerySuffix(e *parser.SubqueryExpr) string {
+	return strings.TrimPrefix(e.String(), e.Expr.String())
+}
+
+// parseGrouping parses the value of the -grouping flag.
+func parseGrouping(v string) (after bool, err error) {
+	switch v {
+	case "", "before":
+		return false, nil
+	case "after":
+		return true, nil
+	}
+	return false, fmt.Errorf("invalid grouping %q (expected: before|after)", v)
+}
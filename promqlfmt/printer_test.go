@@ -0,0 +1,170 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestStyleFormat(t *testing.T) {
+	const agg = `sum by (job, instance) (rate(http_requests_total{code=~"5.."}[5m])) / sum by (job, instance) (rate(http_requests_total[5m]))`
+
+	tests := []struct {
+		name string
+		st   style
+		expr string
+		want string
+	}{
+		{
+			name: "zero style prints like Prometheus",
+			expr: "sum by(job)(rate(x[5m]))>0",
+			want: "sum by (job) (rate(x[5m])) > 0",
+		},
+		{
+			name: "fits in width",
+			st:   style{width: 40},
+			expr: "sum by(job)(rate(x[5m]))>0",
+			want: "sum by (job) (rate(x[5m])) > 0",
+		},
+		{
+			name: "split at width with default indent",
+			st:   style{width: 60},
+			expr: agg,
+			want: `  sum by (job, instance) (
+    rate(http_requests_total{code=~"5.."}[5m])
+  )
+/
+  sum by (job, instance) (rate(http_requests_total[5m]))`,
+		},
+		{
+			name: "tab indent",
+			st:   style{width: 60, indent: "\t", indentSet: true},
+			expr: agg,
+			want: "\tsum by (job, instance) (\n" +
+				"\t\trate(http_requests_total{code=~\"5..\"}[5m])\n" +
+				"\t)\n" +
+				"/\n" +
+				"\tsum by (job, instance) (rate(http_requests_total[5m]))",
+		},
+		{
+			name: "no indent",
+			st:   style{width: 60, indentSet: true},
+			expr: agg,
+			want: `sum by (job, instance) (
+rate(http_requests_total{code=~"5.."}[5m])
+)
+/
+sum by (job, instance) (rate(http_requests_total[5m]))`,
+		},
+		{
+			name: "function arguments one per line",
+			st:   style{width: 50},
+			expr: `histogram_quantile(0.99, sum by (le) (rate(request_duration_seconds_bucket[5m])))`,
+			want: `histogram_quantile(
+  0.99,
+  sum by (le) (
+    rate(request_duration_seconds_bucket[5m])
+  )
+)`,
+		},
+		{
+			name: "grouping after",
+			st:   style{groupingAfter: true},
+			expr: "topk(5, sum by(job)(up))",
+			want: "topk(5, sum(up) by (job))",
+		},
+		{
+			name: "grouping after when split",
+			st:   style{width: 20, groupingAfter: true},
+			expr: "sum without(instance)(rate(x[5m]))",
+			want: `sum(
+  rate(x[5m])
+) without (instance)`,
+		},
+		{
+			name: "minify",
+			st:   style{minify: true},
+			expr: "histogram_quantile(0.9, sum by (le) (rate(x_bucket[5m]))) > 1",
+			want: "histogram_quantile(0.9,sum by (le)(rate(x_bucket[5m]))) > 1",
+		},
+		{
+			name: "minify ignores width",
+			st:   style{minify: true, width: 10},
+			expr: "count_values(\"v\", build_info)",
+			want: `count_values("v",build_info)`,
+		},
+		{
+			name: "minify with grouping after",
+			st:   style{minify: true, groupingAfter: true},
+			expr: "sum by (job) (up)",
+			want: "sum(up) by (job)",
+		},
+		{
+			name: "subquery and unary",
+			st:   style{width: 40},
+			expr: "-max_over_time(rate(http_requests_total[5m])[1h:5m])",
+			want: "-max_over_time(\n  rate(http_requests_total[5m])[1h:5m]\n)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.st.format(tt.expr)
+			if err != nil {
+				t.Fatalf("format: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("format(%q) =\n%s\nwant\n%s", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIndent(t *testing.T) {
+	tests := []struct {
+		v       string
+		want    string
+		wantErr bool
+	}{
+		{v: "tab", want: "\t"},
+		{v: "0", want: ""},
+		{v: "4", want: "    "},
+		{v: "-1", wantErr: true},
+		{v: "two", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.v, func(t *testing.T) {
+			got, err := parseIndent(tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseIndent(%q) error = %v, want error %v", tt.v, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseIndent(%q) = %q, want %q", tt.v, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGrouping(t *testing.T) {
+	tests := []struct {
+		v       string
+		want    bool
+		wantErr bool
+	}{
+		{v: "", want: false},
+		{v: "before", want: false},
+		{v: "after", want: true},
+		{v: "middle", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.v, func(t *testing.T) {
+			got, err := parseGrouping(tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseGrouping(%q) error = %v, want error %v", tt.v, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseGrouping(%q) = %v, want %v", tt.v, got, tt.want)
+			}
+		})
+	}
+}
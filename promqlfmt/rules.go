@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// edit replaces src[start:end] with text.
+type edit struct {
+	start, end int
+	text       string
+}
+
+func applyEdits(src []byte, edits []edit) []byte {
+	if len(edits) == 0 {
+		return src
+	}
+
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+
+	var out bytes.Buffer
+	last := 0
+	for _, e := range edits {
+		out.Write(src[last:e.start])
+		out.WriteString(e.text)
+		last = e.end
+	}
+	out.Write(src[last:])
+
+	return out.Bytes()
+}
+
+// formatRules formats the value of every expr key in a YAML document,
+// such as a Prometheus rule file. Only the expression values are
+// rewritten; comments, ordering and the rest of the layout are left as
+// they are.
+func formatRules(src []byte, st style) ([]byte, error) {
+	lines := newLineIndex(src)
+
+	var edits []edit
+	dec := yaml.NewDecoder(bytes.NewReader(src))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if err := walkExprs(&doc, func(key, value *yaml.Node) error {
+			e, err := exprEdit(src, lines, key, value, st)
+			if err != nil {
+				return err
+			}
+			if e != nil {
+				edits = append(edits, *e)
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return applyEdits(src, edits), nil
+}
+
+// walkExprs calls fn with every scalar expr value of a mapping under n.
+func walkExprs(n *yaml.Node, fn func(key, value *yaml.Node) error) error {
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, c := range n.Content {
+			if err := walkExprs(c, fn); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			if key.Value == "expr" && value.Kind == yaml.ScalarNode && value.Tag == "!!str" {
+				if err := fn(key, value); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := walkExprs(value, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// exprEdit returns the edit that replaces the scalar value with its
+// formatted expression, or nil if it is already formatted.
+func exprEdit(src []byte, lines lineIndex, key, value *yaml.Node, st style) (*edit, error) {
+	if strings.TrimSpace(value.Value) == "" {
+		return nil, nil
+	}
+
+	formatted, err := st.format(value.Value)
+	if err != nil {
+		return nil, exprPosition(src, lines, value, err)
+	}
+
+	if strings.TrimRight(value.Value, "\n") == formatted {
+		return nil, nil
+	}
+
+	start := lines.offset(value.Line, value.Column)
+	keyIndent := key.Column - 1
+	block := value.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0
+
+	var end int
+	switch {
+	case block:
+		end = blockEnd(src, lines, value.Line, keyIndent)
+	case value.Style&yaml.DoubleQuotedStyle != 0:
+		end = quotedEnd(src, start, '"')
+	case value.Style&yaml.SingleQuotedStyle != 0:
+		end = quotedEnd(src, start, '\'')
+	default:
+		end = plainEnd(src, lines, value.Line, start, keyIndent)
+	}
+
+	// A comment after the value on its first line stays on that line.
+	eol := lineEnd(src, lines, value.Line)
+	var comment string
+	if !block && end <= eol {
+		if rest := strings.TrimSpace(string(src[end:eol])); strings.HasPrefix(rest, "#") {
+			comment = rest
+		}
+	}
+
+	if !block && !strings.Contains(formatted, "\n") {
+		n := &yaml.Node{Kind: yaml.ScalarNode, Style: value.Style, Value: formatted}
+		b, err := yaml.Marshal(n)
+		if err != nil {
+			return nil, err
+		}
+		text := strings.TrimSuffix(string(b), "\n")
+		if !strings.Contains(text, "\n") {
+			return &edit{start: start, end: end, text: text}, nil
+		}
+	}
+
+	var header string
+	indent := keyIndent + 2
+	if block {
+		// Keep the chomping indicator, indentation and comment of the
+		// original header, but always use literal style so line breaks
+		// are kept.
+		rest := string(src[start+1 : eol])
+		var chomp string
+		for rest != "" && strings.IndexByte("+-0123456789", rest[0]) >= 0 {
+			if rest[0] == '+' || rest[0] == '-' {
+				chomp = rest[:1]
+			}
+			rest = rest[1:]
+		}
+		header = chomp + rest
+		if ci := blockIndent(src, lines, value.Line); ci > keyIndent {
+			indent = ci
+		}
+	} else if comment != "" {
+		header = " " + comment
+		end = eol
+	}
+
+	// The indentation of a block scalar is taken from its first line
+	// unless given explicitly, which Pretty output indenting the first
+	// line deeper than the rest requires.
+	if strings.HasPrefix(formatted, " ") || strings.HasPrefix(formatted, "\t") {
+		header = strconv.Itoa(indent-keyIndent) + header
+	}
+	header = "|" + header
+
+	var text strings.Builder
+	text.WriteString(header)
+	for _, l := range strings.Split(formatted, "\n") {
+		text.WriteString("\n")
+		if l != "" {
+			text.WriteString(strings.Repeat(" ", indent) + l)
+		}
+	}
+
+	return &edit{start: start, end: end, text: text.String()}, nil
+}
+
+// exprPosition returns err with the position value starts at in src.
+func exprPosition(src []byte, lines lineIndex, value *yaml.Node, err error) *exprError {
+	switch {
+	case value.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+		ci := blockIndent(src, lines, value.Line)
+		return &exprError{line: value.Line + 1, column: ci + 1, indent: ci, err: err}
+	case value.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0:
+		return &exprError{line: value.Line, column: value.Column + 1, indent: value.Column - 1, err: err}
+	default:
+		return &exprError{line: value.Line, column: value.Column, indent: value.Column - 1, err: err}
+	}
+}
+
+// lineIndex holds the offset of the start of every line.
+type lineIndex []int
+
+func newLineIndex(src []byte) lineIndex {
+	idx := lineIndex{0}
+	for i, b := range src {
+		if b == '\n' {
+			idx = append(idx, i+1)
+		}
+	}
+	return idx
+}
+
+// offset returns the offset of the 1-based line and column.
+func (idx lineIndex) offset(line, column int) int {
+	return idx[line-1] + column - 1
+}
+
+func lineAt(src []byte, idx lineIndex, line int) []byte {
+	if line > len(idx) {
+		return nil
+	}
+	start := idx[line-1]
+	end := len(src)
+	if line < len(idx) {
+		end = idx[line] - 1
+	}
+	if start > end {
+		return nil
+	}
+	return src[start:end]
+}
+
+func indentOf(l []byte) int {
+	return len(l) - len(bytes.TrimLeft(l, " "))
+}
+
+func isBlank(l []byte) bool {
+	return len(bytes.TrimSpace(l)) == 0
+}
+
+// blockEnd returns the end of the content of a block scalar whose header
+// is on line, excluding trailing blank lines.
+func blockEnd(src []byte, idx lineIndex, line int, keyIndent int) int {
+	end := lineEnd(src, idx, line)
+	for l := line + 1; l <= len(idx); l++ {
+		b := lineAt(src, idx, l)
+		if isBlank(b) {
+			continue
+		}
+		if indentOf(b) <= keyIndent {
+			break
+		}
+		end = lineEnd(src, idx, l)
+	}
+	return end
+}
+
+// blockIndent returns the indentation of the first content line of a
+// block scalar whose header is on line.
+func blockIndent(src []byte, idx lineIndex, line int) int {
+	for l := line + 1; l <= len(idx); l++ {
+		if b := lineAt(src, idx, l); !isBlank(b) {
+			return indentOf(b)
+		}
+	}
+	return 0
+}
+
+// plainEnd returns the end of a plain scalar starting at start on line,
+// including continuation lines indented deeper than its key.
+func plainEnd(src []byte, idx lineIndex, line int, start int, keyIndent int) int {
+	first := src[start:lineEnd(src, idx, line)]
+	if i := bytes.Index(first, []byte(" #")); i >= 0 {
+		first = first[:i]
+	}
+	end := start + len(bytes.TrimRight(first, " \t"))
+
+	for l := line + 1; l <= len(idx); l++ {
+		b := lineAt(src, idx, l)
+		if isBlank(b) {
+			continue
+		}
+		trimmed := bytes.TrimLeft(b, " ")
+		if indentOf(b) <= keyIndent || trimmed[0] == '#' {
+			break
+		}
+		if i := bytes.Index(b, []byte(" #")); i >= 0 {
+			b = b[:i]
+		}
+		end = idx[l-1] + len(bytes.TrimRight(b, " \t"))
+	}
+	return end
+}
+
+// quotedEnd returns the offset just past the closing quote of a quoted
+// scalar starting at start.
+func quotedEnd(src []byte, start int, quote byte) int {
+	for i := start + 1; i < len(src); i++ {
+		switch {
+		case quote == '"' && src[i] == '\\':
+			i++
+		case src[i] == quote:
+			if quote == '\'' && i+1 < len(src) && src[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(src)
+}
+
+func lineEnd(src []byte, idx lineIndex, line int) int {
+	return idx[line-1] + len(lineAt(src, idx, line))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// channels are prerelease channel names, from the least to the most
+// stable.
+type channels []string
+
+var defaultChannels = channels{"alpha", "beta", "rc"}
+
+var channelName = regexp.MustCompile(`^[A-Za-z][0-9A-Za-z-]*$`)
+
+// parseChannels parses a comma-separated list of channel names.
+func parseChannels(s string) (channels, error) {
+	var cs channels
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if !channelName.MatchString(name) {
+			return nil, fmt.Errorf("invalid channel name: %q", name)
+		}
+		if slices.Contains(cs, name) {
+			return nil, fmt.Errorf("duplicate channel name: %q", name)
+		}
+		cs = append(cs, name)
+	}
+	return cs, nil
+}
+
+// match parses a prerelease such as rc.2 or rc2 into its channel, the
+// separator before its number and the number.
+func (cs channels) match(prerelease string) (channel, separator string, n int, ok bool) {
+	quoted := make([]string, 0, len(cs))
+	for _, c := range cs {
+		quoted = append(quoted, regexp.QuoteMeta(c))
+	}
+
+	re := regexp.MustCompile(`^(` + strings.Join(quoted, "|") + `)(\.)?(\d+)$`)
+	m := re.FindStringSubmatch(prerelease)
+	if m == nil {
+		return "", "", 0, false
+	}
+
+	n, err := strconv.Atoi(m[3])
+	if err != nil {
+		return "", "", 0, false
+	}
+
+	return m[1], m[2], n, true
+}
+
+// convention describes the prereleases of cs for error messages.
+func (cs channels) convention() string {
+	var forms []string
+	for _, c := range cs {
+		forms = append(forms, c+".N")
+	}
+	for _, c := range cs {
+		forms = append(forms, c+"N")
+	}
+	return strings.Join(forms, ", ")
+}
+
+// metadataFlags are the flags setting the build metadata of versions.
+type metadataFlags struct {
+	date *bool
+	sha  *string
+	meta *string
+}
+
+func addMetadataFlags(fs *flag.FlagSet) *metadataFlags {
+	return &metadataFlags{
+		date: fs.Bool("date", false, "add the current UTC date to the build metadata"),
+		sha:  fs.String("sha", "", "add a commit SHA to the build metadata"),
+		meta: fs.String("meta", "", "add dot-separated identifiers to the build metadata"),
+	}
+}
+
+// apply sets the build metadata of v from the flags, in the order date,
+// SHA and the -meta identifiers. v is returned unchanged if no flags are
+// set.
+func (m *metadataFlags) apply(v semver.Version) (semver.Version, error) {
+	var parts []string
+	if *m.date {
+		parts = append(parts, time.Now().UTC().Format("20060102"))
+	}
+	if *m.sha != "" {
+		parts = append(parts, *m.sha)
+	}
+	if *m.meta != "" {
+		parts = append(parts, *m.meta)
+	}
+
+	if len(parts) == 0 {
+		return v, nil
+	}
+
+	nv, err := v.SetMetadata(strings.Join(parts, "."))
+	if err != nil {
+		return v, fmt.Errorf("failed to set metadata: %w", err)
+	}
+
+	return nv, nil
+}
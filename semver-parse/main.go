@@ -3,12 +3,12 @@ package main
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"os"
-	"regexp"
-	"strconv"
+	"slices"
 	"strings"
 
 	"github.com/Masterminds/semver/v3"
@@ -39,12 +39,27 @@ func realMain(
 
 	fs := flag.NewFlagSet(exec, flag.ExitOnError)
 	flagCompact := fs.Bool("c", false, "compact output")
+	flagJSON := fs.Bool("json", false, "output in JSON format")
+
+	bumpFs := flag.NewFlagSet("bump", flag.ExitOnError)
+	flagChannels := bumpFs.String("channels", strings.Join(defaultChannels, ","), "prerelease channels, from the least to the most stable")
+	flagChannel := bumpFs.String("channel", "", "prerelease channel to bump to, defaults to the current one")
+	bumpMeta := addMetadataFlags(bumpFs)
 
 	bumpCmd := &ffcli.Command{
 		Name:       "bump",
-		ShortUsage: fmt.Sprintf("%v bump <patch|minor|major|prerelease>", exec),
+		ShortUsage: fmt.Sprintf("%v bump <patch|minor|major|prerelease> [flags]", exec),
 		ShortHelp:  "Bump version by incrementing patch, minor, major, or prerelease",
+		FlagSet:    bumpFs,
 		Exec: func(ctx context.Context, args []string) error {
+			// Allow flags after the bump type, e.g. bump prerelease --channel rc.
+			if len(args) > 1 {
+				if err := bumpFs.Parse(args[1:]); err != nil {
+					return err
+				}
+				args = append(args[:1], bumpFs.Args()...)
+			}
+
 			if len(args) != 1 {
 				return fmt.Errorf("bump requires exactly one argument: patch, minor, major, or prerelease")
 			}
@@ -54,6 +69,14 @@ func realMain(
 				return fmt.Errorf("invalid bump type: %s (must be patch, minor, major, or prerelease)", bumpType)
 			}
 
+			cs, err := parseChannels(*flagChannels)
+			if err != nil {
+				return err
+			}
+			if *flagChannel != "" && bumpType != "prerelease" {
+				return fmt.Errorf("-channel requires the prerelease bump type")
+			}
+
 			scanner := bufio.NewScanner(stdin)
 			for scanner.Scan() {
 				line := scanner.Text()
@@ -73,7 +96,7 @@ func realMain(
 				case "major":
 					newVersion = version.IncMajor()
 				case "prerelease":
-					bumped, err := bumpPrerelease(*version)
+					bumped, err := bumpPrerelease(*version, cs, *flagChannel)
 					if err != nil {
 						fmt.Fprintf(stderr, "%v: %v\n", err, line)
 						continue
@@ -81,6 +104,12 @@ func realMain(
 					newVersion = *bumped
 				}
 
+				newVersion, err = bumpMeta.apply(newVersion)
+				if err != nil {
+					fmt.Fprintf(stderr, "%v: %v\n", err, line)
+					continue
+				}
+
 				output := newVersion.Original()
 				fmt.Fprintln(stdout, output)
 			}
@@ -90,11 +119,21 @@ func realMain(
 	}
 
 	rootCmd := &ffcli.Command{
-		Name:        exec,
-		ShortUsage:  fmt.Sprintf("%v [flags] [<subcommand>]", exec),
-		FlagSet:     fs,
-		Subcommands: []*ffcli.Command{bumpCmd},
+		Name:       exec,
+		ShortUsage: fmt.Sprintf("%v [flags] [<subcommand>]", exec),
+		FlagSet:    fs,
+		Subcommands: []*ffcli.Command{
+			bumpCmd,
+			matchCommand(exec, stdin, stdout, stderr),
+			sortCommand(exec, stdin, stdout, stderr),
+			nextCommand(exec, stdin, stdout, stderr),
+			promoteCommand(exec, stdin, stdout, stderr),
+		},
 		Exec: func(ctx context.Context, args []string) error {
+			if *flagCompact && *flagJSON {
+				return fmt.Errorf("-c and -json are mutually exclusive")
+			}
+
 			scanner := bufio.NewScanner(stdin)
 			for scanner.Scan() {
 				line := scanner.Text()
@@ -104,6 +143,13 @@ func realMain(
 					continue
 				}
 
+				if *flagJSON {
+					if err := dumpJSON(stdout, version); err != nil {
+						return err
+					}
+					continue
+				}
+
 				dump(stdout, version, *flagCompact)
 			}
 
@@ -114,12 +160,25 @@ func realMain(
 	return rootCmd.ParseAndRun(ctx, args[1:])
 }
 
-func bumpPrerelease(v semver.Version) (*semver.Version, error) {
+// bumpPrerelease bumps the number of the prerelease of v, or moves it to
+// the start of channel if channel is more stable than its current one. A
+// release moves to a prerelease of its next patch version.
+func bumpPrerelease(v semver.Version, cs channels, channel string) (*semver.Version, error) {
+	if channel != "" && !slices.Contains(cs, channel) {
+		return nil, fmt.Errorf("unknown channel: %s (must be one of %s)", channel, strings.Join(cs, ", "))
+	}
+
 	prerelease := v.Prerelease()
 
 	if prerelease == "" {
+		if channel == "" {
+			channel = cs[0]
+		}
 		n := v.IncPatch()
-		n, _ = n.SetPrerelease("alpha.0")
+		n, err := n.SetPrerelease(channel + ".0")
+		if err != nil {
+			return nil, fmt.Errorf("failed to set prerelease: %w", err)
+		}
 		return &n, nil
 	}
 
@@ -133,17 +192,27 @@ func bumpPrerelease(v semver.Version) (*semver.Version, error) {
 		return nil, fmt.Errorf("failed to reset metadata: %w", err)
 	}
 
-	re := regexp.MustCompile(`^(alpha|beta|rc)(\.)?(\d+)$`)
-	if matches := re.FindStringSubmatch(prerelease); matches != nil {
-		prefix := matches[1]
-		separator := matches[2]
-		num, _ := strconv.Atoi(matches[3])
-		newPre := fmt.Sprintf("%s%s%d", prefix, separator, num+1)
-		nv, _ := semver.NewVersion(fmt.Sprintf("%s-%s", ee.Original(), newPre))
-		return nv, nil
+	current, separator, num, ok := cs.match(prerelease)
+	if !ok {
+		return nil, fmt.Errorf("prerelease '%s' does not match convention (%s)", prerelease, cs.convention())
+	}
+
+	var newPre string
+	switch {
+	case channel == "" || channel == current:
+		newPre = fmt.Sprintf("%s%s%d", current, separator, num+1)
+	case slices.Index(cs, channel) > slices.Index(cs, current):
+		newPre = fmt.Sprintf("%s%s0", channel, separator)
+	default:
+		return nil, fmt.Errorf("cannot move prerelease '%s' back to channel %s", prerelease, channel)
+	}
+
+	nv, err := semver.NewVersion(fmt.Sprintf("%s-%s", ee.Original(), newPre))
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, fmt.Errorf("prerelease '%s' does not match convention (alpha.N, beta.N, rc.N, alphaN, betaN, or rcN)", prerelease)
+	return nv, nil
 }
 
 func dump(w io.Writer, v *semver.Version, compact bool) {
@@ -163,3 +232,29 @@ func dump(w io.Writer, v *semver.Version, compact bool) {
 
 	fmt.Fprintln(w, strings.Join(parts, delimiter))
 }
+
+type versionJSON struct {
+	Version    string `json:"version"`
+	Major      uint64 `json:"major"`
+	Minor      uint64 `json:"minor"`
+	Patch      uint64 `json:"patch"`
+	Prerelease string `json:"prerelease"`
+	Metadata   string `json:"metadata"`
+}
+
+func dumpJSON(w io.Writer, v *semver.Version) error {
+	b, err := json.Marshal(versionJSON{
+		Version:    v.String(),
+		Major:      v.Major(),
+		Minor:      v.Minor(),
+		Patch:      v.Patch(),
+		Prerelease: v.Prerelease(),
+		Metadata:   v.Metadata(),
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%s\n", b)
+	return nil
+}
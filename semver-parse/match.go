@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func matchCommand(exec string, stdin io.Reader, stdout, stderr io.Writer) *ffcli.Command {
+	fs := flag.NewFlagSet("match", flag.ExitOnError)
+	flagExplain := fs.Bool("explain", false, "explain why versions do not match on stderr")
+	flagMax := fs.Bool("max", false, "print only the highest matching version")
+	flagMin := fs.Bool("min", false, "print only the lowest matching version")
+
+	return &ffcli.Command{
+		Name:       "match",
+		ShortUsage: fmt.Sprintf("%v match [-explain] [-max|-min] <constraint>", exec),
+		ShortHelp:  "Print versions satisfying a constraint such as '>=1.2, <2'",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("match requires exactly one argument: the constraint")
+			}
+			if *flagMax && *flagMin {
+				return fmt.Errorf("-max and -min are mutually exclusive")
+			}
+
+			constraints, err := semver.NewConstraint(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid constraint: %w", err)
+			}
+
+			var best *semver.Version
+
+			scanner := bufio.NewScanner(stdin)
+			for scanner.Scan() {
+				line := scanner.Text()
+
+				version, err := semver.NewVersion(line)
+				if err != nil {
+					fmt.Fprintf(stderr, "%v: %v\n", err, line)
+					continue
+				}
+
+				ok, errs := constraints.Validate(version)
+				if !ok {
+					if *flagExplain {
+						for _, err := range errs {
+							fmt.Fprintln(stderr, err)
+						}
+					}
+					continue
+				}
+
+				switch {
+				case *flagMax:
+					if best == nil || version.GreaterThan(best) {
+						best = version
+					}
+				case *flagMin:
+					if best == nil || version.LessThan(best) {
+						best = version
+					}
+				default:
+					fmt.Fprintln(stdout, version.Original())
+				}
+			}
+
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+
+			if *flagMax || *flagMin {
+				if best == nil {
+					return fmt.Errorf("no version satisfies %s", constraints)
+				}
+				fmt.Fprintln(stdout, best.Original())
+			}
+
+			return nil
+		},
+	}
+}
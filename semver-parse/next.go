@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+// bumpLevel is the part of a version a change requires bumping.
+type bumpLevel int
+
+const (
+	bumpNone bumpLevel = iota
+	bumpPatch
+	bumpMinor
+	bumpMajor
+)
+
+func (l bumpLevel) String() string {
+	switch l {
+	case bumpPatch:
+		return "patch"
+	case bumpMinor:
+		return "minor"
+	case bumpMajor:
+		return "major"
+	}
+	return "none"
+}
+
+var (
+	// conventionalHeader matches the header of a Conventional Commit,
+	// e.g. "feat(api)!: drop v1".
+	conventionalHeader = regexp.MustCompile(`^(\w+)(?:\(([^)]*)\))?(!)?: (.*)$`)
+	// breakingFooter matches a footer announcing a breaking change.
+	breakingFooter = regexp.MustCompile(`^BREAKING[ -]CHANGE: `)
+)
+
+// commit is a commit message.
+type commit struct {
+	header string
+	body   []string
+}
+
+// level returns the bump c requires by the Conventional Commits rules.
+func (c commit) level() bumpLevel {
+	m := conventionalHeader.FindStringSubmatch(c.header)
+	if m == nil {
+		return bumpNone
+	}
+
+	if m[3] == "!" {
+		return bumpMajor
+	}
+	for _, line := range c.body {
+		if breakingFooter.MatchString(line) {
+			return bumpMajor
+		}
+	}
+
+	switch m[1] {
+	case "feat":
+		return bumpMinor
+	case "fix":
+		return bumpPatch
+	}
+
+	return bumpNone
+}
+
+// parseCommits parses commit messages. Messages are separated by NUL
+// bytes if nul. Otherwise a Conventional Commit header starts a new
+// message at the start of a paragraph, or right after the header of a
+// message without a body, as in a list of subjects. Paragraphs of a body
+// that look like a header, e.g. "note: ...", are taken for messages then.
+func parseCommits(r io.Reader, nul bool) ([]commit, error) {
+	scanner := bufio.NewScanner(r)
+	if nul {
+		scanner.Split(splitNUL)
+	}
+
+	var (
+		commits []commit
+		blank   bool
+	)
+	for scanner.Scan() {
+		if nul {
+			lines := strings.Split(strings.TrimSpace(scanner.Text()), "\n")
+			if lines[0] != "" {
+				commits = append(commits, commit{header: lines[0], body: lines[1:]})
+			}
+			continue
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		header := conventionalHeader.MatchString(line) && !breakingFooter.MatchString(line)
+		switch {
+		case len(commits) == 0 && line != "",
+			header && (blank || len(commits[len(commits)-1].body) == 0):
+			commits = append(commits, commit{header: line})
+		case len(commits) > 0:
+			c := &commits[len(commits)-1]
+			c.body = append(c.body, line)
+		}
+		blank = line == ""
+	}
+
+	return commits, scanner.Err()
+}
+
+func splitNUL(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// nextVersion returns the version following v for a change of level. A
+// prerelease stays on its channel as long as it already covers level,
+// e.g. 1.3.0-rc.1 becomes 1.3.0-rc.2 for a fix or a feature but
+// 2.0.0-rc.0 for a breaking change.
+func nextVersion(v *semver.Version, level bumpLevel, cs channels) (*semver.Version, error) {
+	if level == bumpNone {
+		return v, nil
+	}
+
+	if v.Prerelease() == "" {
+		next := increment(*v, level)
+		return &next, nil
+	}
+
+	covered := bumpPatch
+	switch {
+	case v.Minor() == 0 && v.Patch() == 0:
+		covered = bumpMajor
+	case v.Patch() == 0:
+		covered = bumpMinor
+	}
+
+	if level <= covered {
+		return bumpPrerelease(*v, cs, "")
+	}
+
+	channel, separator, _, ok := cs.match(v.Prerelease())
+	if !ok {
+		return nil, fmt.Errorf("prerelease '%s' does not match convention (%s)", v.Prerelease(), cs.convention())
+	}
+
+	// Bump from the release the prerelease precedes.
+	release, err := v.SetPrerelease("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to reset prerelease: %w", err)
+	}
+	release = increment(release, level)
+
+	next, err := release.SetPrerelease(channel + separator + "0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to set prerelease: %w", err)
+	}
+
+	return &next, nil
+}
+
+func increment(v semver.Version, level bumpLevel) semver.Version {
+	switch level {
+	case bumpMajor:
+		return v.IncMajor()
+	case bumpMinor:
+		return v.IncMinor()
+	}
+	return v.IncPatch()
+}
+
+func nextCommand(exec string, stdin io.Reader, stdout, stderr io.Writer) *ffcli.Command {
+	fs := flag.NewFlagSet("next", flag.ExitOnError)
+	flagExplain := fs.Bool("explain", false, "list the commits driving the bump on stderr")
+	flagNUL := fs.Bool("z", false, "commit messages are separated by NUL bytes, as by git log -z")
+	flagChannels := fs.String("channels", strings.Join(defaultChannels, ","), "prerelease channels, from the least to the most stable")
+
+	return &ffcli.Command{
+		Name:       "next",
+		ShortUsage: fmt.Sprintf("%v next [-explain] [-z] <current-version>", exec),
+		ShortHelp:  "Print the next version for the Conventional Commits on stdin",
+		LongHelp: "Reads commit messages, e.g. from git log -z --format=%B with -z, and\n" +
+			"bumps the major version for breaking changes, the minor version for\n" +
+			"features and the patch version for fixes.\n\n" +
+			"Without -z, a header such as \"fix: ...\" starts a new message at the\n" +
+			"start of a paragraph, so body paragraphs that look like one are taken\n" +
+			"for messages; use -z to read bodies reliably.",
+		FlagSet: fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("next requires exactly one argument: the current version")
+			}
+
+			current, err := semver.NewVersion(args[0])
+			if err != nil {
+				return fmt.Errorf("%v: %v", err, args[0])
+			}
+
+			cs, err := parseChannels(*flagChannels)
+			if err != nil {
+				return err
+			}
+
+			commits, err := parseCommits(stdin, *flagNUL)
+			if err != nil {
+				return err
+			}
+
+			level := bumpNone
+			for _, c := range commits {
+				level = max(level, c.level())
+			}
+
+			next, err := nextVersion(current, level, cs)
+			if err != nil {
+				return err
+			}
+
+			if *flagExplain {
+				if level == bumpNone {
+					fmt.Fprintf(stderr, "no commits require a release\n")
+				}
+				for _, c := range commits {
+					if level != bumpNone && c.level() == level {
+						fmt.Fprintf(stderr, "%s: %s\n", level, c.header)
+					}
+				}
+			}
+
+			fmt.Fprintln(stdout, next.Original())
+
+			return nil
+		},
+	}
+}
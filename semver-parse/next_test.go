@@ -0,0 +1,135 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseCommits(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		nul   bool
+		want  []commit
+	}{
+		{
+			name:  "subjects",
+			input: "fix: a\nfeat(api): b\nchore: c\n",
+			want: []commit{
+				{header: "fix: a"},
+				{header: "feat(api): b"},
+				{header: "chore: c"},
+			},
+		},
+		{
+			name:  "bodies separated by blank lines",
+			input: "feat: a\n\nSome detail.\n\nfix: b\n\nBREAKING CHANGE: gone\n",
+			want: []commit{
+				{header: "feat: a", body: []string{"", "Some detail.", ""}},
+				{header: "fix: b", body: []string{"", "BREAKING CHANGE: gone"}},
+			},
+		},
+		{
+			name:  "header-like body line inside a paragraph",
+			input: "feat: a\n\nSee the docs.\nnote: this is not a commit\n",
+			want: []commit{
+				{header: "feat: a", body: []string{"", "See the docs.", "note: this is not a commit"}},
+			},
+		},
+		{
+			name:  "non-conventional first message",
+			input: "Merge branch 'main'\nfix: a\n",
+			want: []commit{
+				{header: "Merge branch 'main'"},
+				{header: "fix: a"},
+			},
+		},
+		{
+			name:  "NUL separated",
+			input: "feat: a\n\nnote: body\n\x00fix: b\n\x00",
+			nul:   true,
+			want: []commit{
+				{header: "feat: a", body: []string{"", "note: body"}},
+				{header: "fix: b", body: []string{}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCommits(strings.NewReader(tt.input), tt.nul)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(commit{})); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCommitLevel(t *testing.T) {
+	tests := []struct {
+		c    commit
+		want bumpLevel
+	}{
+		{commit{header: "chore: deps"}, bumpNone},
+		{commit{header: "Merge branch 'main'"}, bumpNone},
+		{commit{header: "fix: a"}, bumpPatch},
+		{commit{header: "feat(api): a"}, bumpMinor},
+		{commit{header: "refactor!: a"}, bumpMajor},
+		{commit{header: "fix: a", body: []string{"", "BREAKING CHANGE: gone"}}, bumpMajor},
+		{commit{header: "fix: a", body: []string{"", "BREAKING-CHANGE: gone"}}, bumpMajor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.c.header, func(t *testing.T) {
+			if got := tt.c.level(); got != tt.want {
+				t.Errorf("level() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextVersion(t *testing.T) {
+	tests := []struct {
+		current string
+		level   bumpLevel
+		want    string
+	}{
+		{"1.2.3", bumpNone, "1.2.3"},
+		{"1.2.3", bumpPatch, "1.2.4"},
+		{"1.2.3", bumpMinor, "1.3.0"},
+		{"1.2.3", bumpMajor, "2.0.0"},
+		{"v1.2.3", bumpMinor, "v1.3.0"},
+		{"1.3.0-rc.1", bumpPatch, "1.3.0-rc.2"},
+		{"1.3.0-rc.1", bumpMinor, "1.3.0-rc.2"},
+		{"1.3.0-rc.1", bumpMajor, "2.0.0-rc.0"},
+		{"1.0.1-rc.0", bumpPatch, "1.0.1-rc.1"},
+		{"1.0.1-rc.0", bumpMinor, "1.1.0-rc.0"},
+		{"2.0.0-beta.1", bumpMajor, "2.0.0-beta.2"},
+		{"1.3.0-beta1", bumpMajor, "2.0.0-beta0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.current+"/"+tt.level.String(), func(t *testing.T) {
+			got, err := nextVersion(semver.MustParse(tt.current), tt.level, defaultChannels)
+			if err != nil {
+				t.Fatalf("next: %v", err)
+			}
+			if got.Original() != tt.want {
+				t.Errorf("next = %s, want %s", got.Original(), tt.want)
+			}
+		})
+	}
+}
+
+func TestNextVersionUnknownChannel(t *testing.T) {
+	_, err := nextVersion(semver.MustParse("1.3.0-preview.1"), bumpMajor, defaultChannels)
+	if err == nil {
+		t.Fatal("next: got no error for a prerelease outside the channels")
+	}
+}
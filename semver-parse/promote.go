@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func promoteCommand(exec string, stdin io.Reader, stdout, stderr io.Writer) *ffcli.Command {
+	fs := flag.NewFlagSet("promote", flag.ExitOnError)
+	meta := addMetadataFlags(fs)
+
+	return &ffcli.Command{
+		Name:       "promote",
+		ShortUsage: fmt.Sprintf("%v promote [flags]", exec),
+		ShortHelp:  "Promote prereleases to their release, e.g. 1.4.0-rc.2 to 1.4.0",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("promote takes no arguments")
+			}
+
+			scanner := bufio.NewScanner(stdin)
+			for scanner.Scan() {
+				line := scanner.Text()
+
+				version, err := semver.NewVersion(line)
+				if err != nil {
+					fmt.Fprintf(stderr, "%v: %v\n", err, line)
+					continue
+				}
+
+				if version.Prerelease() == "" {
+					fmt.Fprintf(stderr, "not a prerelease: %v\n", line)
+					continue
+				}
+
+				// The metadata of the prerelease build does not apply to
+				// the release.
+				release, err := version.SetPrerelease("")
+				if err == nil {
+					release, err = release.SetMetadata("")
+				}
+				if err == nil {
+					release, err = meta.apply(release)
+				}
+				if err != nil {
+					fmt.Fprintf(stderr, "%v: %v\n", err, line)
+					continue
+				}
+
+				fmt.Fprintln(stdout, release.Original())
+			}
+
+			return scanner.Err()
+		},
+	}
+}
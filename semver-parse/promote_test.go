@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPromote(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		input      string
+		wantStdout string
+		wantStderr string
+	}{
+		{
+			name:       "prereleases",
+			input:      "1.4.0-rc.2\nv2.0.0-beta.1+build.5\n",
+			wantStdout: "1.4.0\nv2.0.0\n",
+		},
+		{
+			name:       "releases and invalid versions are skipped",
+			input:      "1.4.0\nnope\n1.5.0-alpha.0\n",
+			wantStdout: "1.5.0\n",
+			wantStderr: "not a prerelease: 1.4.0\nInvalid Semantic Version: nope\n",
+		},
+		{
+			name:       "build metadata",
+			args:       []string{"-sha", "abc123", "-meta", "ci.7"},
+			input:      "1.4.0-rc.2+old\n",
+			wantStdout: "1.4.0+abc123.ci.7\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			cmd := promoteCommand("semver-parse", strings.NewReader(tt.input), &stdout, &stderr)
+			if err := cmd.ParseAndRun(context.Background(), tt.args); err != nil {
+				t.Fatalf("promote: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.wantStdout, stdout.String()); diff != "" {
+				t.Errorf("stdout mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantStderr, stderr.String()); diff != "" {
+				t.Errorf("stderr mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+func sortCommand(exec string, stdin io.Reader, stdout, stderr io.Writer) *ffcli.Command {
+	fs := flag.NewFlagSet("sort", flag.ExitOnError)
+	flagReverse := fs.Bool("r", false, "sort in descending order")
+	flagUnique := fs.Bool("u", false, "print only the first of equal versions")
+	flagGroup := fs.String("group", "", "print one line per major or minor line: major or minor")
+
+	return &ffcli.Command{
+		Name:       "sort",
+		ShortUsage: fmt.Sprintf("%v sort [-r] [-u] [-group major|minor]", exec),
+		ShortHelp:  "Sort versions by semver precedence",
+		FlagSet:    fs,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("sort takes no arguments")
+			}
+			if *flagGroup != "" && *flagGroup != "major" && *flagGroup != "minor" {
+				return fmt.Errorf("invalid group: %s (must be major or minor)", *flagGroup)
+			}
+
+			var versions []*semver.Version
+
+			scanner := bufio.NewScanner(stdin)
+			for scanner.Scan() {
+				line := scanner.Text()
+
+				version, err := semver.NewVersion(line)
+				if err != nil {
+					fmt.Fprintf(stderr, "%v: %v\n", err, line)
+					continue
+				}
+
+				versions = append(versions, version)
+			}
+
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+
+			// Stable, so that -u keeps the first of equal versions.
+			sort.SliceStable(versions, func(i, j int) bool {
+				if *flagReverse {
+					return versions[i].GreaterThan(versions[j])
+				}
+				return versions[i].LessThan(versions[j])
+			})
+
+			if *flagUnique {
+				versions = dedupe(versions)
+			}
+
+			if *flagGroup == "" {
+				for _, v := range versions {
+					fmt.Fprintln(stdout, v.Original())
+				}
+				return nil
+			}
+
+			var (
+				keys   []string
+				groups = map[string][]string{}
+			)
+			for _, v := range versions {
+				key := fmt.Sprintf("%d", v.Major())
+				if *flagGroup == "minor" {
+					key = fmt.Sprintf("%d.%d", v.Major(), v.Minor())
+				}
+				if _, ok := groups[key]; !ok {
+					keys = append(keys, key)
+				}
+				groups[key] = append(groups[key], v.Original())
+			}
+
+			for _, key := range keys {
+				fmt.Fprintf(stdout, "%s: %s\n", key, strings.Join(groups[key], " "))
+			}
+
+			return nil
+		},
+	}
+}
+
+// dedupe removes versions equal to the one before them from sorted
+// versions. Versions differing only in metadata are equal.
+func dedupe(versions []*semver.Version) []*semver.Version {
+	var unique []*semver.Version
+	for _, v := range versions {
+		if len(unique) > 0 && unique[len(unique)-1].Equal(v) {
+			continue
+		}
+		unique = append(unique, v)
+	}
+	return unique
+}